@@ -0,0 +1,135 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/cli"
+	"github.com/Arzeeq/cloud-camp/internal/pool"
+)
+
+var commands = []cli.Command{
+	{Name: "list", Usage: "list backends with their state and stats", Run: runList},
+	{Name: "drain", Args: "<url>", Usage: "stop sending new requests to backend and remove it when its requests finish", Run: runDrain},
+	{Name: "undrain", Args: "<url>", Usage: "return draining backend to rotation", Run: runUndrain},
+	{Name: "add", Args: "<url>", Usage: "add backend to pool", Run: runAdd},
+	{Name: "remove", Args: "<url>", Usage: "remove backend from pool at once, its requests in flight still finish", Run: runRemove},
+	{Name: "check", Usage: "check health of all backends now", Run: runCheck},
+	{Name: "config", Usage: "show effective config of load balancer", Run: runConfig},
+}
+
+func main() {
+	cli.Main("lbctl", "http://localhost:8090", commands)
+}
+
+func printBackends(p cli.Printer, backends []pool.Backend) error {
+	rows := make([][]string, 0, len(backends))
+	for _, b := range backends {
+		state := "healthy"
+		if !b.Healthy {
+			state = "unhealthy"
+		}
+		if b.Draining {
+			state += ",draining"
+		}
+
+		checked := "-"
+		if !b.CheckedAt.IsZero() {
+			checked = b.CheckedAt.Format(time.RFC3339)
+		}
+
+		circuit := b.Circuit
+		if circuit == "" {
+			circuit = "-"
+		}
+
+		rows = append(rows, []string{
+			b.URL, state, circuit, strconv.FormatFloat(b.Weight, 'f', 2, 64), strconv.FormatInt(b.InFlight, 10),
+			strconv.FormatInt(b.Requests, 10), checked, b.Since.Format(time.RFC3339),
+		})
+	}
+
+	return p.Print(backends, []string{"URL", "STATE", "CIRCUIT", "WEIGHT", "IN_FLIGHT", "REQUESTS", "CHECKED_AT", "SINCE"}, rows)
+}
+
+func runList(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 0, "")
+
+	var backends []pool.Backend
+	if err := c.Call(http.MethodGet, "/backends", nil, nil, &backends); err != nil {
+		return err
+	}
+
+	return printBackends(p, backends)
+}
+
+func runCheck(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("check", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 0, "")
+
+	var backends []pool.Backend
+	if err := c.Call(http.MethodPost, "/healthcheck", nil, nil, &backends); err != nil {
+		return err
+	}
+
+	return printBackends(p, backends)
+}
+
+// change calls endpoint changing backend given by the only argument
+func change(name, method, path string, inQuery bool, done string) func(c *cli.Client, p cli.Printer, args []string) error {
+	return func(c *cli.Client, p cli.Printer, args []string) error {
+		fs := flag.NewFlagSet(name, flag.ExitOnError)
+		cli.ParseArgs(fs, args, 1, "<url>")
+
+		var query url.Values
+		var body any = map[string]string{"url": fs.Arg(0)}
+		if inQuery {
+			query, body = url.Values{"url": {fs.Arg(0)}}, nil
+		}
+
+		err := c.Call(method, path, query, body, nil)
+		switch {
+		case errors.Is(err, cli.ErrNotFound):
+			return fmt.Errorf("backend %s is not in pool", fs.Arg(0))
+		case errors.Is(err, cli.ErrConflict):
+			return fmt.Errorf("backend %s is already in pool", fs.Arg(0))
+		case err != nil:
+			return err
+		}
+
+		p.Message("backend %s is %s", fs.Arg(0), done)
+		return nil
+	}
+}
+
+var (
+	runDrain   = change("drain", http.MethodPost, "/backends/drain", false, "draining")
+	runUndrain = change("undrain", http.MethodPost, "/backends/undrain", false, "undrained")
+	runAdd     = change("add", http.MethodPost, "/backends", false, "added")
+	runRemove  = change("remove", http.MethodDelete, "/backends", true, "removed")
+)
+
+func runConfig(c *cli.Client, _ cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("config", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 0, "")
+
+	resp, err := c.Do(http.MethodGet, "/config", nil, "", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return cli.APIError(resp)
+	}
+	defer resp.Body.Close()
+
+	_, err = io.Copy(os.Stdout, resp.Body)
+	return err
+}
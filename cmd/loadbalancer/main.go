@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"flag"
 	"fmt"
@@ -10,12 +11,19 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/Arzeeq/cloud-camp/internal/auth"
 	"github.com/Arzeeq/cloud-camp/internal/config"
+	"github.com/Arzeeq/cloud-camp/internal/handler"
 	"github.com/Arzeeq/cloud-camp/internal/healthcheck"
+	"github.com/Arzeeq/cloud-camp/internal/keyhash"
+	"github.com/Arzeeq/cloud-camp/internal/limiter"
 	"github.com/Arzeeq/cloud-camp/internal/loadbalancer"
 	"github.com/Arzeeq/cloud-camp/internal/logger"
 	"github.com/Arzeeq/cloud-camp/internal/pool"
+	"github.com/Arzeeq/cloud-camp/internal/ratelimiter"
 )
 
 func main() {
@@ -41,7 +49,10 @@ func main() {
 	l.Info("config was loaded")
 
 	// initialize servers pool
-	pool, err := initPool(cfg.Algorithm, cfg.Servers)
+	pool, err := initPool(cfg.Algorithm, cfg.Servers,
+		pool.WithDrainTimeout(cfg.DrainTimeout),
+		pool.WithSlowStart(cfg.SlowStart.Window, cfg.SlowStart.MinWeight),
+	)
 	if err != nil {
 		l.Error(err.Error())
 		return
@@ -54,31 +65,105 @@ func main() {
 	defer hc.Stop()
 	l.Info("healthchecker was activated")
 
-	stop := make(chan os.Signal, 1)
-	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+	if cfg.AdminPort != 0 {
+		mux := http.NewServeMux()
+		handler.NewPoolHandler(pool, hc, cfg, l).Register(mux)
+		if err := auth.Serve(cfg.AdminPort, cfg.Admin, nil, mux, l); err != nil {
+			l.Error(err.Error())
+			return
+		}
+	}
 
-	go func() {
-		lb, err := loadbalancer.New(pool, l)
+	lb, err := loadbalancer.New(pool, cfg.CircuitBreaker, l)
+	if err != nil {
+		l.Error(fmt.Sprintf("failed to create load balancer instance: %v", err))
+		return
+	}
+
+	pool.OnRemove(lb.Forget)
+
+	var h http.Handler = lb
+	if cfg.RateLimiter.Enabled {
+		rl, stopLimiter, err := initRateLimiter(&cfg.RateLimiter, l)
 		if err != nil {
-			l.Error(fmt.Sprintf("failed to create load balancer instance: %v", err))
+			l.Error(err.Error())
 			return
 		}
+		defer stopLimiter()
 
+		h = rl.Middleware(lb)
+		l.Info("rate limiter was activated", slog.String("storage", cfg.RateLimiter.Storage))
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, syscall.SIGINT, syscall.SIGTERM)
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           h,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	go func() {
 		l.Info("starting load balancer", slog.Int("port", cfg.Port))
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), lb); err != nil {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 			l.Error(fmt.Sprintf("load balancer has encountered an error: %v", err))
 		}
 	}()
 
 	<-stop
 	l.Info("Shutting down load balancer gracefully")
+
+	// in-flight requests are finished before rate limiter state is flushed
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		l.Error(fmt.Sprintf("failed to shut down load balancer: %v", err))
+	}
 }
 
-func initPool(alg pool.Algo, servers []string) (pool.Pooler, error) {
+func initPool(alg pool.Algo, servers []string, opts ...pool.Option) (pool.Pooler, error) {
 	switch alg {
 	case pool.RoundRobin:
-		return pool.NewRoundRobinPool(servers)
+		return pool.NewRoundRobinPool(servers, opts...)
 	}
 
 	return nil, errors.New("unexpected algorith name")
 }
+
+// initRateLimiter builds rate limiter with state kept in memory or in Postgres.
+// Returned function stops rate limiter and closes database
+func initRateLimiter(cfg *config.EdgeLimiter, l *slog.Logger) (*ratelimiter.RateLimiter, func(), error) {
+	// memory state does not outlive the process, so random secret is enough for it
+	hasher, err := keyhash.FromEnv(cfg.KeyHashEnv, cfg.Storage == config.StorageMemory)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if cfg.Storage == config.StorageMemory {
+		return limiter.New(&cfg.Limiter, nil, hasher, l)
+	}
+
+	db, err := limiter.OpenDB(cfg.MigrationDir, cfg.GetConnStr(), hasher, l)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	services := limiter.NewServices(db, hasher, cfg.Location)
+	if cfg.TokenPort != 0 {
+		if err := services.Serve(cfg.TokenPort, cfg.Admin, cfg.Location, l); err != nil {
+			db.Close()
+			return nil, nil, err
+		}
+	}
+
+	rl, stop, err := limiter.New(&cfg.Limiter, services, hasher, l)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return rl, func() {
+		stop()
+		db.Close()
+	}, nil
+}
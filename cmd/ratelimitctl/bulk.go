@@ -0,0 +1,127 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Arzeeq/cloud-camp/internal/cli"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+var contentTypes = map[string]string{
+	model.FormatCSV:    "text/csv",
+	model.FormatJSON:   "application/json",
+	model.FormatNDJSON: "application/x-ndjson",
+}
+
+func runImport(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	format := fs.String("format", "", "one of [csv, json, ndjson], taken from file extension by default")
+	dryRun := fs.Bool("dry-run", false, "only validate rows")
+	cli.ParseArgs(fs, args, 1, "<file|->")
+
+	name := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(name), ".")
+		if *format == "jsonl" {
+			*format = model.FormatNDJSON
+		}
+	}
+	contentType, ok := contentTypes[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, use -format", *format)
+	}
+
+	var body io.Reader = os.Stdin
+	if name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return fmt.Errorf("failed to open rows: %w", err)
+		}
+		defer f.Close()
+		body = f
+	}
+
+	query := url.Values{"format": {*format}}
+	if *dryRun {
+		query.Set("dry_run", "true")
+	}
+
+	resp, err := c.Do(http.MethodPost, "/tokens/import", query, contentType, body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusUnprocessableEntity {
+		return cli.APIError(resp)
+	}
+	defer resp.Body.Close()
+
+	var report model.ImportReport
+	if err := json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		return fmt.Errorf("failed to decode import report: %w", err)
+	}
+
+	if p.JSON {
+		if err := p.Print(report, nil, nil); err != nil {
+			return err
+		}
+	} else {
+		for _, e := range report.Errors {
+			fmt.Fprintf(os.Stderr, "row %d: %s\n", e.Row, e.Error)
+		}
+	}
+	if len(report.Errors) > 0 {
+		return fmt.Errorf("%d of %d rows are invalid, nothing was imported", len(report.Errors), report.Rows)
+	}
+
+	if report.DryRun {
+		p.Message("%d rows are valid", report.Rows)
+	} else {
+		p.Message("%d rows imported", report.Imported)
+	}
+
+	return nil
+}
+
+func runExport(c *cli.Client, _ cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	format := fs.String("format", model.FormatNDJSON, "one of [csv, json, ndjson]")
+	output := fs.String("file", "-", "output file, - means stdout")
+	cli.ParseArgs(fs, args, 0, "")
+	if _, ok := contentTypes[*format]; !ok {
+		return fmt.Errorf("unknown format %q", *format)
+	}
+
+	resp, err := c.Do(http.MethodGet, "/tokens/export", url.Values{"format": {*format}}, "", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return cli.APIError(resp)
+	}
+	defer resp.Body.Close()
+
+	var w io.Writer = os.Stdout
+	if *output != "-" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create output: %w", err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return errors.Join(errors.New("export is incomplete"), err)
+	}
+
+	return nil
+}
@@ -0,0 +1,19 @@
+package main
+
+import "github.com/Arzeeq/cloud-camp/internal/cli"
+
+var commands = []cli.Command{
+	{Name: "get", Args: "<token>", Usage: "show stored settings of token", Run: runGet},
+	{Name: "set", Args: "<token> <capacity>", Usage: "set capacity of token, unknown token is created", Run: runSet},
+	{Name: "delete", Args: "<token>", Usage: "delete token with its schedules", Run: runDelete},
+	{Name: "list", Usage: "list stored tokens by their hashes", Run: runList},
+	{Name: "import", Args: "<file|->", Usage: "import token capacities from csv, json or ndjson", Run: runImport},
+	{Name: "export", Usage: "export all stored tokens", Run: runExport},
+	{Name: "usage", Args: "<token>", Usage: "show allowed and rejected requests of token", Run: runUsage},
+	{Name: "ban", Args: "<token> <duration>", Usage: "reject requests of token for duration", Run: runBan},
+	{Name: "unban", Args: "<token>", Usage: "lift ban of token", Run: runUnban},
+}
+
+func main() {
+	cli.Main("ratelimitctl", "http://localhost:9000", commands)
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/cli"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+var recordHeader = []string{"TOKEN_HASH", "PREFIX", "CAPACITY", "TENANT", "MAX_IN_FLIGHT", "EXPIRES_AT", "REVOKED_AT"}
+
+func recordRow(t model.TokenRecord) []string {
+	prefix := t.KeyPrefix
+	if prefix == "" {
+		prefix = "-"
+	}
+
+	return []string{t.TokenHash, prefix, strconv.Itoa(t.Capacity), cli.CellString(t.Tenant), cli.CellInt(t.MaxInFlight), cli.CellTime(t.ExpiresAt), cli.CellTime(t.RevokedAt)}
+}
+
+func tokenPath(token string, suffix string) string {
+	return "/tokens/" + url.PathEscape(token) + suffix
+}
+
+func runGet(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 1, "<token>")
+
+	var t model.TokenRecord
+	err := c.Call(http.MethodGet, tokenPath(fs.Arg(0), ""), nil, nil, &t)
+	if errors.Is(err, cli.ErrNotFound) {
+		return errors.New("token is not stored, default capacity is applied to it")
+	}
+	if err != nil {
+		return err
+	}
+
+	return p.Print(t, recordHeader, [][]string{recordRow(t)})
+}
+
+func runSet(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("set", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 2, "<token> <capacity>")
+
+	capacity, err := strconv.Atoi(fs.Arg(1))
+	if err != nil || capacity < 0 {
+		return fmt.Errorf("capacity must be a non-negative integer, got %q", fs.Arg(1))
+	}
+
+	body := map[string]any{"token": fs.Arg(0), "capacity": capacity}
+	if err := c.Call(http.MethodPost, "/", nil, body, nil); err != nil {
+		return err
+	}
+
+	p.Message("capacity is set to %d", capacity)
+	return nil
+}
+
+func runDelete(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("delete", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 1, "<token>")
+
+	err := c.Call(http.MethodDelete, tokenPath(fs.Arg(0), ""), nil, nil, nil)
+	if errors.Is(err, cli.ErrNotFound) {
+		return errors.New("token is not stored")
+	}
+	if err != nil {
+		return err
+	}
+
+	p.Message("token is deleted")
+	return nil
+}
+
+func runList(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("list", flag.ExitOnError)
+	limit := fs.Int("limit", 100, "tokens per page, at most 1000")
+	after := fs.String("after", "", "list tokens with hash greater than this one")
+	all := fs.Bool("all", false, "list all pages")
+	cli.ParseArgs(fs, args, 0, "")
+
+	var tokens []model.TokenRecord
+	cursor := *after
+	for {
+		var page []model.TokenRecord
+		query := url.Values{"limit": {strconv.Itoa(*limit)}, "after": {cursor}}
+		if err := c.Call(http.MethodGet, "/tokens", query, nil, &page); err != nil {
+			return err
+		}
+
+		tokens = append(tokens, page...)
+		if !*all || len(page) < *limit {
+			break
+		}
+		cursor = page[len(page)-1].TokenHash
+	}
+
+	if tokens == nil {
+		tokens = []model.TokenRecord{}
+	}
+
+	rows := make([][]string, 0, len(tokens))
+	for _, t := range tokens {
+		rows = append(rows, recordRow(t))
+	}
+
+	return p.Print(tokens, recordHeader, rows)
+}
+
+func runUsage(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	from := fs.String("from", "", "start of period in RFC 3339, a day before -to by default")
+	to := fs.String("to", "", "end of period in RFC 3339, now by default")
+	granularity := fs.String("granularity", "hour", "one of [minute, hour, day, month]")
+	cli.ParseArgs(fs, args, 1, "<token>")
+
+	query := url.Values{"granularity": {*granularity}}
+	if *from != "" {
+		query.Set("from", *from)
+	}
+	if *to != "" {
+		query.Set("to", *to)
+	}
+
+	var usage []model.Usage
+	if err := c.Call(http.MethodGet, tokenPath(fs.Arg(0), "/usage"), query, nil, &usage); err != nil {
+		return err
+	}
+
+	rows := make([][]string, 0, len(usage))
+	for _, u := range usage {
+		rows = append(rows, []string{u.Start.Format(time.RFC3339), strconv.FormatInt(u.Allowed, 10), strconv.FormatInt(u.Rejected, 10)})
+	}
+
+	return p.Print(usage, []string{"START", "ALLOWED", "REJECTED"}, rows)
+}
+
+func runBan(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("ban", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 2, "<token> <duration>")
+
+	if _, err := time.ParseDuration(fs.Arg(1)); err != nil {
+		return fmt.Errorf("failed to parse duration: %w", err)
+	}
+
+	var ban model.Ban
+	body := map[string]string{"token": fs.Arg(0), "duration": fs.Arg(1)}
+	if err := c.Call(http.MethodPost, "/bans", nil, body, &ban); err != nil {
+		return err
+	}
+
+	return p.Print(ban, []string{"TOKEN_HASH", "BANNED_UNTIL"}, [][]string{{ban.Token, ban.BannedUntil.Format(time.RFC3339)}})
+}
+
+func runUnban(c *cli.Client, p cli.Printer, args []string) error {
+	fs := flag.NewFlagSet("unban", flag.ExitOnError)
+	cli.ParseArgs(fs, args, 1, "<token>")
+
+	err := c.Call(http.MethodDelete, "/bans/"+url.PathEscape(fs.Arg(0)), nil, nil, nil)
+	if errors.Is(err, cli.ErrNotFound) {
+		return errors.New("token is not banned")
+	}
+	if err != nil {
+		return err
+	}
+
+	p.Message("token is unbanned")
+	return nil
+}
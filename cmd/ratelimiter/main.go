@@ -2,31 +2,30 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
+	"time"
+	_ "time/tzdata"
 
-	"github.com/Arzeeq/cloud-camp/internal/bucket"
 	"github.com/Arzeeq/cloud-camp/internal/config"
 	"github.com/Arzeeq/cloud-camp/internal/handler"
+	"github.com/Arzeeq/cloud-camp/internal/healthcheck"
+	"github.com/Arzeeq/cloud-camp/internal/keyhash"
+	"github.com/Arzeeq/cloud-camp/internal/limiter"
 	"github.com/Arzeeq/cloud-camp/internal/logger"
-	"github.com/Arzeeq/cloud-camp/internal/ratelimiter"
-	"github.com/Arzeeq/cloud-camp/internal/service"
-	"github.com/Arzeeq/cloud-camp/internal/storage/pg"
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/Arzeeq/cloud-camp/internal/pool"
+	"github.com/Arzeeq/cloud-camp/internal/proxy"
 )
 
-type myHandler int
-
-func (h *myHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	w.Write([]byte("hello"))
-}
-
 func main() {
 	quit := make(chan os.Signal, 1)
 	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
@@ -53,49 +52,97 @@ func main() {
 	}
 	l.Info("config was loaded")
 
-	// initialize token service
-	tokenService, err := initTokenService(cfg.MigrationDir, cfg.GetConnStr())
+	// keys are stored hashed, so the secret must survive restarts
+	hasher, err := keyhash.FromEnv(cfg.KeyHashEnv, false)
 	if err != nil {
 		l.Error(err.Error())
 		return
 	}
-	l.Info("token service was initialized")
 
-	// mount token handler
-	tokenHandler := handler.NewTokenHandler(tokenService, l)
-	go func() {
-		l.Info("starting listening", slog.Int("port", cfg.TokenPort))
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", cfg.TokenPort), http.HandlerFunc(tokenHandler.SetCapacity)); err != nil {
-			l.Error("token handler has encountered an error")
+	// initialize database
+	db, err := limiter.OpenDB(cfg.MigrationDir, cfg.GetConnStr(), hasher, l)
+	if err != nil {
+		l.Error(err.Error())
+		return
+	}
+	defer db.Close()
+
+	services := limiter.NewServices(db, hasher, cfg.Location)
+	l.Info("services were initialized")
+
+	// mount token handlers
+	if err := services.Serve(cfg.TokenPort, cfg.Admin, cfg.Location, l); err != nil {
+		l.Error(err.Error())
+		return
+	}
+
+	rl, stop, err := limiter.New(&cfg.Limiter, services, hasher, l)
+	if err != nil {
+		l.Error(err.Error())
+		return
+	}
+	defer stop()
+
+	// serve decisions to external proxies
+	var decisionSrv *http.Server
+	if cfg.DecisionPort != 0 {
+		decisionMux := http.NewServeMux()
+		handler.NewDecisionHandler(rl, l).Register(decisionMux)
+		decisionSrv = &http.Server{
+			Addr:              net.JoinHostPort(cfg.DecisionHost, strconv.Itoa(cfg.DecisionPort)),
+			Handler:           decisionMux,
+			ReadHeaderTimeout: 10 * time.Second,
 		}
-	}()
+		go func() {
+			l.Info("starting listening", slog.String("host", cfg.DecisionHost), slog.Int("port", cfg.DecisionPort))
+			if err := decisionSrv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				l.Error(fmt.Sprintf("decision handler has encountered an error: %v", err))
+			}
+		}()
+	}
 
-	b := bucket.New(cfg.DefaultCapacity, cfg.Interval, tokenService)
-	defer b.Stop()
+	// initialize upstream proxy
+	upstreams, err := pool.NewRoundRobinPool(cfg.Upstream.Servers)
+	if err != nil {
+		l.Error(err.Error())
+		return
+	}
+	if cfg.Upstream.HealthCheckInterval > 0 {
+		hc := healthcheck.New(upstreams, l, cfg.Upstream.HealthCheckInterval)
+		hc.Start()
+		defer hc.Stop()
+		l.Info("healthchecker was activated")
+	}
+	upstream, err := proxy.New(cfg.Upstream, upstreams, l)
+	if err != nil {
+		l.Error(err.Error())
+		return
+	}
 
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", cfg.Port),
+		Handler:           rl.Middleware(upstream),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
 	go func() {
-		var h myHandler
 		l.Info("starting listening", slog.Int("port", cfg.Port))
-		http.ListenAndServe(fmt.Sprintf(":%d", cfg.Port), ratelimiter.New(b, l).Middleware(&h))
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			l.Error(fmt.Sprintf("rate limiter has encountered an error: %v", err))
+		}
 	}()
 
 	<-quit
 	l.Info("Gracefully shutting down application")
-}
 
-func initTokenService(migDir, connStr string) (*service.TokenService, error) {
-	// initialize connections pool
-	pool, err := pgxpool.New(context.Background(), connStr)
-	if err != nil {
-		return nil, fmt.Errorf("failed to initialize connections pool: %v", err.Error())
+	// let in-flight requests reach upstream before limiter state is flushed
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		l.Error(fmt.Sprintf("failed to shut down rate limiter: %v", err))
 	}
-
-	// migrate up
-	migrator := pg.NewMigrator(migDir, connStr)
-	if err := migrator.Up(); err != nil {
-		return nil, fmt.Errorf("failed to migrate up: %v", err.Error())
+	if decisionSrv != nil {
+		if err := decisionSrv.Shutdown(ctx); err != nil {
+			l.Error(fmt.Sprintf("failed to shut down decision handler: %v", err))
+		}
 	}
-
-	tokenStorage := pg.NewTokenStorage(pool)
-	return service.NewTokenService(tokenStorage), nil
 }
@@ -0,0 +1,184 @@
+package access
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type Servicer interface {
+	ListEntries() ([]model.AccessEntry, error)
+}
+
+type KeyHasher interface {
+	Hash(key string) string
+}
+
+type rule struct {
+	list      string
+	key       string
+	network   *net.IPNet
+	expiresAt *time.Time
+}
+
+// Lists keeps static and database allow and deny lists in memory.
+// Database entries are reloaded every interval so checks never touch the database
+type Lists struct {
+	static  []rule
+	dynamic []rule
+	mu      sync.RWMutex
+	ticker  *time.Ticker
+	done    chan struct{}
+	service Servicer
+	l       *slog.Logger
+}
+
+// New creates lists from static entries, service may be nil when only static lists are used.
+// Static keys are hashed with hasher, database keys are stored hashed
+func New(allow, deny []string, interval time.Duration, hasher KeyHasher, service Servicer, l *slog.Logger) (*Lists, error) {
+	lists := &Lists{
+		done:    make(chan struct{}),
+		service: service,
+		l:       l,
+	}
+
+	for _, e := range allow {
+		r, err := newRule(model.AccessEntry{List: model.ListAllow, Entry: e})
+		if err != nil {
+			return nil, err
+		}
+		if r.key != "" {
+			r.key = hasher.Hash(r.key)
+		}
+		lists.static = append(lists.static, r)
+	}
+	for _, e := range deny {
+		r, err := newRule(model.AccessEntry{List: model.ListDeny, Entry: e})
+		if err != nil {
+			return nil, err
+		}
+		if r.key != "" {
+			r.key = hasher.Hash(r.key)
+		}
+		lists.static = append(lists.static, r)
+	}
+
+	if service != nil {
+		lists.reload()
+		lists.ticker = time.NewTicker(interval)
+		go lists.refresh()
+	}
+
+	return lists, nil
+}
+
+func newRule(e model.AccessEntry) (rule, error) {
+	r := rule{list: e.List, expiresAt: e.ExpiresAt}
+
+	n, err := ParseNetwork(e.Entry)
+	if err != nil {
+		return r, err
+	}
+	if n != nil {
+		r.network = n
+		return r, nil
+	}
+
+	r.key = e.Entry
+	return r, nil
+}
+
+// ParseNetwork returns network of IP or CIDR entry and nil for API key.
+// Entry containing "/" must be a valid CIDR, single IP is a network of one address
+func ParseNetwork(entry string) (*net.IPNet, error) {
+	if strings.Contains(entry, "/") {
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CIDR '%s': %w", entry, err)
+		}
+		return n, nil
+	}
+
+	if ip := net.ParseIP(entry); ip != nil {
+		bits := 128
+		if ip.To4() != nil {
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+
+	return nil, nil
+}
+
+func (l *Lists) refresh() {
+	for {
+		select {
+		case <-l.ticker.C:
+			l.reload()
+		case <-l.done:
+			return
+		}
+	}
+}
+
+func (l *Lists) reload() {
+	entries, err := l.service.ListEntries()
+	if err != nil {
+		l.l.Error(fmt.Sprintf("failed to reload access lists: %v", err))
+		return
+	}
+
+	dynamic := make([]rule, 0, len(entries))
+	for _, e := range entries {
+		r, err := newRule(e)
+		if err != nil {
+			l.l.Warn("skipping invalid access entry", slog.Int64("id", e.ID), slog.String("error", err.Error()))
+			continue
+		}
+		dynamic = append(dynamic, r)
+	}
+
+	l.mu.Lock()
+	l.dynamic = dynamic
+	l.mu.Unlock()
+}
+
+// Check returns list which key hash or ip belongs to, deny wins over allow. Empty key or nil ip are not checked
+func (l *Lists) Check(key string, ip net.IP) string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	now := time.Now()
+	verdict := ""
+	for _, rules := range [][]rule{l.static, l.dynamic} {
+		for _, r := range rules {
+			if r.expiresAt != nil && !now.Before(*r.expiresAt) {
+				continue
+			}
+
+			matched := (r.key != "" && r.key == key) || (r.network != nil && ip != nil && r.network.Contains(ip))
+			if !matched {
+				continue
+			}
+
+			if r.list == model.ListDeny {
+				return model.ListDeny
+			}
+			verdict = model.ListAllow
+		}
+	}
+
+	return verdict
+}
+
+func (l *Lists) Stop() {
+	if l.ticker != nil {
+		l.ticker.Stop()
+	}
+	close(l.done)
+}
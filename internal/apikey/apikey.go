@@ -0,0 +1,173 @@
+package apikey
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"golang.org/x/sync/singleflight"
+)
+
+// KeyPrefix starts every issued key, so leaked keys are easy to find in code and logs
+const KeyPrefix = "rl_"
+
+// Generate returns new key and its visible prefix, the prefix identifies key when the key itself is not known
+func Generate() (string, string, error) {
+	id := make([]byte, 6)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", fmt.Errorf("failed to generate key: %w", err)
+	}
+
+	prefix := KeyPrefix + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+type Servicer interface {
+	GetKeyByHash(hash string) (model.APIKey, error)
+}
+
+type entry struct {
+	key      model.APIKey
+	loadedAt time.Time
+}
+
+// Validator rejects expired and revoked keys, keys unknown to storage are rejected only when issued keys are required.
+// Key state is cached for ttl, so revocation takes effect within ttl. Unknown keys are cached by time of lookup only,
+// and concurrent lookups of the same key are collapsed into one
+type Validator struct {
+	ttl           time.Duration
+	requireIssued bool
+	entries       map[string]entry
+	unknown       map[string]time.Time
+	mu            sync.Mutex
+	group         singleflight.Group
+	ticker        *time.Ticker
+	done          chan struct{}
+	service       Servicer
+	l             *slog.Logger
+}
+
+func NewValidator(ttl time.Duration, requireIssued bool, service Servicer, l *slog.Logger) *Validator {
+	v := &Validator{
+		ttl:           ttl,
+		requireIssued: requireIssued,
+		entries:       make(map[string]entry),
+		unknown:       make(map[string]time.Time),
+		done:          make(chan struct{}),
+		service:       service,
+		l:             l,
+	}
+
+	v.ticker = time.NewTicker(ttl)
+	go v.cleanup()
+
+	return v
+}
+
+func (v *Validator) cleanup() {
+	for {
+		select {
+		case <-v.ticker.C:
+			v.mu.Lock()
+			for hash, e := range v.entries {
+				if time.Since(e.loadedAt) > v.ttl {
+					delete(v.entries, hash)
+				}
+			}
+			for hash, loadedAt := range v.unknown {
+				if time.Since(loadedAt) > v.ttl {
+					delete(v.unknown, hash)
+				}
+			}
+			v.mu.Unlock()
+		case <-v.done:
+			return
+		}
+	}
+}
+
+// Validate returns model.ErrKeyExpired or model.ErrKeyRevoked when key hash belongs to a key which can not be used,
+// model.ErrKeyUnknown when issued keys are required and model.ErrKeyUnverified when key state can not be loaded
+// while issued keys are required. Otherwise key which is not cached gets default limits while storage is unavailable
+func (v *Validator) Validate(hash string) error {
+	now := time.Now()
+
+	v.mu.Lock()
+	e, ok := v.entries[hash]
+	loadedAt, unknown := v.unknown[hash]
+	v.mu.Unlock()
+
+	switch {
+	case ok && now.Sub(e.loadedAt) <= v.ttl:
+		return e.key.Check(now)
+	case unknown && now.Sub(loadedAt) <= v.ttl:
+		return v.unknownErr()
+	}
+
+	loaded, err, _ := v.group.Do(hash, func() (any, error) {
+		return v.load(hash)
+	})
+	if err != nil {
+		v.l.Error(fmt.Sprintf("failed to load key state: %v", err))
+		if ok {
+			// keep the stale state rather than letting revoked key in while storage is unavailable
+			return e.key.Check(now)
+		}
+		if v.requireIssued {
+			return model.ErrKeyUnverified
+		}
+		return nil
+	}
+
+	key := loaded.(*model.APIKey)
+	if key == nil {
+		return v.unknownErr()
+	}
+
+	return key.Check(now)
+}
+
+// load returns nil key when storage does not know it
+func (v *Validator) load(hash string) (*model.APIKey, error) {
+	key, err := v.service.GetKeyByHash(hash)
+	if errors.Is(err, model.ErrNotFound) {
+		v.mu.Lock()
+		v.unknown[hash] = time.Now()
+		delete(v.entries, hash)
+		v.mu.Unlock()
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	v.mu.Lock()
+	v.entries[hash] = entry{key: key, loadedAt: time.Now()}
+	delete(v.unknown, hash)
+	v.mu.Unlock()
+
+	return &key, nil
+}
+
+func (v *Validator) unknownErr() error {
+	if v.requireIssued {
+		return model.ErrKeyUnknown
+	}
+
+	return nil
+}
+
+func (v *Validator) Stop() {
+	v.ticker.Stop()
+	close(v.done)
+}
@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/config"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type Servicer interface {
+	GetAdminToken(hash string) (model.AdminToken, error)
+}
+
+type actorKey struct{}
+
+// minBootstrapLength rejects placeholders and other guessable bootstrap tokens
+const minBootstrapLength = 32
+
+// Authenticator protects admin API with bearer tokens and client certificates.
+// Safe methods require read scope, all the others require write scope
+type Authenticator struct {
+	service    Servicer
+	bootstrap  string
+	certScopes map[string]string
+	l          *slog.Logger
+}
+
+// New creates authenticator, bootstrap token has write scope and is not stored anywhere, empty one is disabled.
+// Cert scopes map common names of verified client certificates to scopes
+func New(service Servicer, bootstrap string, certScopes map[string]string, l *slog.Logger) (*Authenticator, error) {
+	if bootstrap != "" && len(bootstrap) < minBootstrapLength {
+		return nil, fmt.Errorf("bootstrap token must be at least %d characters long", minBootstrapLength)
+	}
+	for cn, scope := range certScopes {
+		if scope != model.ScopeRead && scope != model.ScopeWrite {
+			return nil, fmt.Errorf("unexpected scope '%s' of certificate '%s'", scope, cn)
+		}
+	}
+
+	a := &Authenticator{service: service, certScopes: certScopes, l: l}
+	if bootstrap != "" {
+		a.bootstrap = HashToken(bootstrap)
+	}
+
+	return a, nil
+}
+
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		actor, scope, err := a.authenticate(r)
+		if err != nil {
+			a.l.Debug("admin request was not authenticated", slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		required := model.ScopeWrite
+		if r.Method == http.MethodGet || r.Method == http.MethodHead {
+			required = model.ScopeRead
+		}
+		if required == model.ScopeWrite && scope != model.ScopeWrite {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), actorKey{}, actor)))
+	})
+}
+
+// Serve starts admin API on port in background, every request is authenticated.
+// Nil service means only bootstrap token and client certificates are accepted
+func Serve(port int, cfg config.Admin, service Servicer, h http.Handler, l *slog.Logger) error {
+	bootstrap := os.Getenv(cfg.BootstrapTokenEnv)
+	if bootstrap == "" {
+		l.Warn("bootstrap token is not set, admin API accepts only stored tokens and client certificates", slog.String("env", cfg.BootstrapTokenEnv))
+	}
+
+	authenticator, err := New(service, bootstrap, cfg.CertScopes, l)
+	if err != nil {
+		return err
+	}
+
+	srv := &http.Server{
+		Addr:              fmt.Sprintf(":%d", port),
+		Handler:           authenticator.Middleware(h),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	if cfg.ClientCA != "" {
+		pem, err := os.ReadFile(cfg.ClientCA)
+		if err != nil {
+			return fmt.Errorf("failed to read client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.New("no certificates found in client CA")
+		}
+
+		// bearer tokens are still accepted from clients without certificate
+		srv.TLSConfig = &tls.Config{
+			ClientAuth: tls.VerifyClientCertIfGiven,
+			ClientCAs:  pool,
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	go func() {
+		l.Info("starting listening", slog.Int("port", port), slog.Bool("tls", cfg.TLSCert != ""))
+
+		var err error
+		if cfg.TLSCert != "" {
+			err = srv.ListenAndServeTLS(cfg.TLSCert, cfg.TLSKey)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil {
+			l.Error(fmt.Sprintf("admin handler has encountered an error: %v", err))
+		}
+	}()
+
+	return nil
+}
+
+// authenticate returns actor and its scope, client certificate is preferred over bearer token
+func (a *Authenticator) authenticate(r *http.Request) (string, string, error) {
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if scope, ok := a.certScopes[cn]; ok {
+			return "cert:" + cn, scope, nil
+		}
+	}
+
+	header := r.Header.Get("Authorization")
+	if len(header) <= 7 || !strings.EqualFold(header[:7], "bearer ") {
+		return "", "", errors.New("no credentials provided")
+	}
+
+	hash := HashToken(strings.TrimSpace(header[7:]))
+	if a.bootstrap != "" && subtle.ConstantTimeCompare([]byte(hash), []byte(a.bootstrap)) == 1 {
+		return "token:bootstrap", model.ScopeWrite, nil
+	}
+
+	if a.service == nil {
+		return "", "", errors.New("unknown token")
+	}
+
+	t, err := a.service.GetAdminToken(hash)
+	if err != nil {
+		return "", "", err
+	}
+
+	return "token:" + t.Name, t.Scope, nil
+}
+
+// Actor returns who made the authenticated request
+func Actor(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	if actor == "" {
+		return "anonymous"
+	}
+
+	return actor
+}
+
+// HashToken returns hex encoded SHA-256 of the token, tokens are random so no salt is needed
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
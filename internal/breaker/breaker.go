@@ -0,0 +1,206 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/config"
+)
+
+type State string
+
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half-open"
+)
+
+// buckets is how many parts rolling window is split into, older parts are dropped as window rolls
+const buckets = 10
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+	slow     int
+}
+
+// Breaker watches results of requests to one server. Closed breaker lets every request through and opens
+// when too many requests within rolling window fail or are slow. Open breaker rejects requests until open timeout
+// passes, then half-open breaker lets a few probes through and closes when all of them succeed.
+// Changes are reported in order under notifyMu, notified is the last reported state
+type Breaker struct {
+	mu       sync.Mutex
+	cfg      config.CircuitBreaker
+	state    State
+	window   [buckets]bucket
+	probes   int
+	passed   int
+	timer    *time.Timer
+	notifyMu sync.Mutex
+	notified State
+	onChange func(State)
+}
+
+// New creates closed breaker, onChange is called without lock on every change of state and by Notify
+func New(cfg config.CircuitBreaker, onChange func(State)) *Breaker {
+	return &Breaker{cfg: cfg, state: Closed, onChange: onChange}
+}
+
+// Allow reports whether request may be sent, allowed request must be finished with Record or Release
+func (b *Breaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case Closed:
+		return true
+	case HalfOpen:
+		if b.probes < b.cfg.HalfOpenProbes {
+			b.probes++
+			return true
+		}
+	}
+
+	return false
+}
+
+// Record counts result of allowed request, latency is time until response headers were received
+func (b *Breaker) Record(failed bool, latency time.Duration) {
+	slow := b.cfg.SlowThreshold > 0 && latency > b.cfg.SlowThreshold
+
+	b.mu.Lock()
+	changed := false
+	switch b.state {
+	case Closed:
+		bk := b.bucket(time.Now())
+		bk.total++
+		if failed {
+			bk.failures++
+		}
+		if slow {
+			bk.slow++
+		}
+
+		if b.tripped() {
+			b.open()
+			changed = true
+		}
+	case HalfOpen:
+		// request sent before breaker opened is not a probe
+		if b.passed >= b.probes {
+			break
+		}
+		if failed || slow {
+			b.open()
+			changed = true
+			break
+		}
+
+		b.passed++
+		if b.passed >= b.cfg.HalfOpenProbes {
+			b.state = Closed
+			b.window = [buckets]bucket{}
+			changed = true
+		}
+	}
+	b.mu.Unlock()
+
+	if changed {
+		b.Notify()
+	}
+}
+
+// Release finishes allowed request which has no result, for example because client has gone away
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == HalfOpen && b.probes > b.passed {
+		b.probes--
+	}
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.state
+}
+
+// Notify calls onChange with the current state unless it was the last one reported.
+// Current state is read under notification lock, so late notification can not override a newer state
+func (b *Breaker) Notify() {
+	b.notifyMu.Lock()
+	defer b.notifyMu.Unlock()
+
+	state := b.State()
+	if state == b.notified {
+		return
+	}
+
+	b.notified = state
+	b.onChange(state)
+}
+
+// Stop cancels pending transition to half-open state
+func (b *Breaker) Stop() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+}
+
+// open opens breaker and schedules half-open state, caller must hold the lock
+func (b *Breaker) open() {
+	b.state = Open
+	b.timer = time.AfterFunc(b.cfg.OpenTimeout, func() {
+		b.mu.Lock()
+		if b.state != Open {
+			b.mu.Unlock()
+			return
+		}
+		b.state = HalfOpen
+		b.probes = 0
+		b.passed = 0
+		b.mu.Unlock()
+
+		b.Notify()
+	})
+}
+
+// bucket returns bucket of rolling window for now, stale bucket is reset, caller must hold the lock
+func (b *Breaker) bucket(now time.Time) *bucket {
+	size := b.cfg.Window / buckets
+	start := now.Truncate(size)
+
+	bk := &b.window[(start.UnixNano()/int64(size))%buckets]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+
+	return bk
+}
+
+// tripped reports whether requests within rolling window exceed thresholds, caller must hold the lock
+func (b *Breaker) tripped() bool {
+	since := time.Now().Add(-b.cfg.Window)
+
+	var total, failures, slow int
+	for _, bk := range b.window {
+		if bk.start.After(since) {
+			total += bk.total
+			failures += bk.failures
+			slow += bk.slow
+		}
+	}
+
+	if total == 0 || total < b.cfg.MinRequests {
+		return false
+	}
+
+	return float64(failures)/float64(total) >= b.cfg.ErrorRate ||
+		(b.cfg.SlowThreshold > 0 && float64(slow)/float64(total) >= b.cfg.SlowRate)
+}
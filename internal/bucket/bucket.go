@@ -6,24 +6,46 @@ import (
 )
 
 type TokenServicer interface {
-	GetCapacity(token string) (int, error)
+	// GetLimits returns capacity of the token, tenant which owns it and capacity of the tenant
+	GetLimits(token string) (int, string, int, error)
 }
 
+// limits of token as stored, they are fetched without holding the mutex
+type limits struct {
+	capacity       int
+	tenant         string
+	tenantCapacity int
+}
+
+// Bucket checks every request against token, tenant and global limits at once.
+// Tokens are taken from all of them or from none. Keys are hashed by rate limiter before they get here,
+// so bucket holds hashes only and forgets them after an hour of inactivity
 type Bucket struct {
 	defaultCapacity int
+	globals         []*Global
 	tokens          map[string]int
+	limits          map[string]limits
+	tenants         map[string]int
+	tenantCapacity  map[string]int
 	lastAccess      map[string]time.Time
+	refilled        chan struct{}
 	mutex           sync.Mutex
 	ticker          *time.Ticker
 	done            chan struct{}
 	tokenService    TokenServicer
 }
 
-func New(defaultCapacity int, interval time.Duration, tokenService TokenServicer) *Bucket {
+// New creates bucket, globals are shared with other buckets and stopped by their owner
+func New(defaultCapacity int, globals []*Global, interval time.Duration, tokenService TokenServicer) *Bucket {
 	b := &Bucket{
 		defaultCapacity: defaultCapacity,
+		globals:         globals,
 		tokens:          make(map[string]int),
+		limits:          make(map[string]limits),
+		tenants:         make(map[string]int),
+		tenantCapacity:  make(map[string]int),
 		lastAccess:      make(map[string]time.Time),
+		refilled:        make(chan struct{}),
 		done:            make(chan struct{}),
 		tokenService:    tokenService,
 	}
@@ -39,22 +61,57 @@ func (b *Bucket) refill() {
 		select {
 		case <-b.ticker.C:
 			b.mutex.Lock()
-
+			keys := make([]string, 0, len(b.tokens))
 			for key := range b.tokens {
 				if time.Since(b.lastAccess[key]) > time.Hour {
 					delete(b.tokens, key)
+					delete(b.limits, key)
 					delete(b.lastAccess, key)
 					continue
 				}
+				keys = append(keys, key)
+			}
+			b.mutex.Unlock()
+
+			// slow storage must not stall requests, so limits are fetched before the mutex is taken again
+			fetched := make(map[string]limits, len(keys))
+			for _, key := range keys {
+				fetched[key] = b.fetch(key)
+			}
+
+			b.mutex.Lock()
+
+			// debts of post-hoc debits are carried over to the next interval
+			tenantDebt := make(map[string]int)
+			for tenant, left := range b.tenants {
+				if left < 0 {
+					tenantDebt[tenant] = left
+				}
+			}
 
-				capacity, err := b.tokenService.GetCapacity(key)
-				if err != nil {
-					b.tokens[key] = b.defaultCapacity
-				} else {
-					b.tokens[key] = capacity
+			clear(b.tenants)
+			clear(b.tenantCapacity)
+
+			for key, left := range b.tokens {
+				l, ok := fetched[key]
+				if !ok {
+					// key was loaded after limits were fetched
+					l = b.limits[key]
 				}
+
+				b.apply(key, l)
+				b.tokens[key] += min(0, left)
 			}
 
+			for tenant, debt := range tenantDebt {
+				if _, ok := b.tenants[tenant]; ok {
+					b.tenants[tenant] += debt
+				}
+			}
+
+			close(b.refilled)
+			b.refilled = make(chan struct{})
+
 			b.mutex.Unlock()
 		case <-b.done:
 			return
@@ -63,24 +120,133 @@ func (b *Bucket) refill() {
 }
 
 func (b *Bucket) Take(token string) bool {
+	return b.TakeN(token, 1)
+}
+
+// TakeN takes cost tokens from token, tenant and global limits or nothing if any of them lacks tokens
+func (b *Bucket) TakeN(token string, cost int) bool {
+	b.load(token)
+
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
-	if _, ok := b.tokens[token]; !ok {
-		capacity, err := b.tokenService.GetCapacity(token)
-		if err != nil {
-			b.tokens[token] = b.defaultCapacity
-		} else {
-			b.tokens[token] = capacity
+	tenant := b.limits[token].tenant
+	if b.tokens[token] < cost || (tenant != "" && b.tenants[tenant] < cost) {
+		return false
+	}
+
+	// tokens taken from globals are returned when one of them lacks tokens
+	for i, g := range b.globals {
+		if !g.take(cost, false) {
+			for _, taken := range b.globals[:i] {
+				taken.take(-cost, true)
+			}
+			return false
 		}
 	}
 
-	if b.tokens[token] > 0 {
-		b.tokens[token]--
+	b.take(token, cost)
+
+	return true
+}
+
+// Debit takes n tokens after the fact, limits may go below zero and the debt is carried to the next interval
+func (b *Bucket) Debit(token string, n int) {
+	b.load(token)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	for _, g := range b.globals {
+		g.take(n, true)
+	}
+	b.take(token, n)
+}
+
+// Remaining returns how many tokens token may take in the current interval
+func (b *Bucket) Remaining(token string) int {
+	b.load(token)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	remaining := b.tokens[token]
+	if tenant := b.limits[token].tenant; tenant != "" {
+		remaining = min(remaining, b.tenants[tenant])
+	}
+	for _, g := range b.globals {
+		remaining = min(remaining, g.remaining())
+	}
+
+	return max(0, remaining)
+}
+
+// Refilled returns channel which is closed on the next refill
+func (b *Bucket) Refilled() <-chan struct{} {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	return b.refilled
+}
+
+// take takes tokens of token and its tenant, globals are taken by callers, must be called under mutex
+func (b *Bucket) take(token string, n int) {
+	b.tokens[token] -= n
+	if tenant := b.limits[token].tenant; tenant != "" {
+		b.tenants[tenant] -= n
+	}
+	b.lastAccess[token] = time.Now()
+}
+
+// load fetches limits of token unknown to bucket, storage is queried without holding the mutex
+func (b *Bucket) load(token string) {
+	b.mutex.Lock()
+	_, ok := b.tokens[token]
+	b.mutex.Unlock()
+	if ok {
+		return
+	}
+
+	l := b.fetch(token)
+
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	if _, ok := b.tokens[token]; !ok {
+		b.apply(token, l)
+		// refill must not forget key before it is used
 		b.lastAccess[token] = time.Now()
-		return true
 	}
-	return false
+}
+
+// fetch falls back to default capacity when token service is not set or token is unknown
+func (b *Bucket) fetch(token string) limits {
+	l := limits{capacity: b.defaultCapacity}
+	if b.tokenService == nil {
+		return l
+	}
+
+	if capacity, tenant, tenantCapacity, err := b.tokenService.GetLimits(token); err == nil {
+		l.capacity = capacity
+		l.tenant = tenant
+		l.tenantCapacity = tenantCapacity
+	}
+
+	return l
+}
+
+// apply resets token to its capacity and attaches it to tenant, must be called under mutex
+func (b *Bucket) apply(token string, l limits) {
+	b.tokens[token] = l.capacity
+	b.limits[token] = l
+
+	if l.tenant == "" {
+		return
+	}
+	if _, ok := b.tenantCapacity[l.tenant]; !ok {
+		b.tenantCapacity[l.tenant] = l.tenantCapacity
+		b.tenants[l.tenant] = l.tenantCapacity
+	}
 }
 
 func (b *Bucket) Stop() {
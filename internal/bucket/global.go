@@ -0,0 +1,67 @@
+package bucket
+
+import (
+	"sync"
+	"time"
+)
+
+// Global is a ceiling shared by all tokens of the buckets it is passed to.
+// It is refilled every interval and debts of post-hoc debits are carried over
+type Global struct {
+	capacity int
+	left     int
+	mutex    sync.Mutex
+	ticker   *time.Ticker
+	done     chan struct{}
+}
+
+func NewGlobal(capacity int, interval time.Duration) *Global {
+	g := &Global{
+		capacity: capacity,
+		left:     capacity,
+		done:     make(chan struct{}),
+	}
+
+	g.ticker = time.NewTicker(interval)
+	go g.refill()
+
+	return g
+}
+
+func (g *Global) refill() {
+	for {
+		select {
+		case <-g.ticker.C:
+			g.mutex.Lock()
+			g.left = g.capacity + min(0, g.left)
+			g.mutex.Unlock()
+		case <-g.done:
+			return
+		}
+	}
+}
+
+// take takes n tokens, it takes nothing and returns false when there are not enough of them unless force is set
+func (g *Global) take(n int, force bool) bool {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if !force && g.left < n {
+		return false
+	}
+
+	g.left -= n
+	return true
+}
+
+func (g *Global) remaining() int {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	return g.left
+}
+
+func (g *Global) Stop() {
+	g.ticker.Stop()
+	close(g.done)
+}
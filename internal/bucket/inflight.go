@@ -0,0 +1,112 @@
+package bucket
+
+import (
+	"sync"
+	"time"
+)
+
+type InFlightServicer interface {
+	GetMaxInFlight(token string) (int, error)
+}
+
+type cachedLimit struct {
+	limit    int
+	loadedAt time.Time
+}
+
+// InFlight limits how many requests a token may have in flight at once, zero limit means no limit
+type InFlight struct {
+	defaultLimit int
+	ttl          time.Duration
+	limits       map[string]cachedLimit
+	active       map[string]int
+	mutex        sync.Mutex
+	ticker       *time.Ticker
+	done         chan struct{}
+	service      InFlightServicer
+}
+
+// NewInFlight creates limiter, cached limits expire after interval to pick up changes
+func NewInFlight(defaultLimit int, interval time.Duration, service InFlightServicer) *InFlight {
+	f := &InFlight{
+		defaultLimit: defaultLimit,
+		ttl:          interval,
+		limits:       make(map[string]cachedLimit),
+		active:       make(map[string]int),
+		done:         make(chan struct{}),
+		service:      service,
+	}
+
+	f.ticker = time.NewTicker(interval)
+	go f.refresh()
+
+	return f
+}
+
+func (f *InFlight) refresh() {
+	for {
+		select {
+		case <-f.ticker.C:
+			f.mutex.Lock()
+			for token, c := range f.limits {
+				if time.Since(c.loadedAt) > f.ttl {
+					delete(f.limits, token)
+				}
+			}
+			f.mutex.Unlock()
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// Acquire returns false if token has no free slot. Limit of token is fetched without holding the mutex,
+// so slow storage delays only requests of that token
+func (f *InFlight) Acquire(token string) bool {
+	f.mutex.Lock()
+	c, ok := f.limits[token]
+	f.mutex.Unlock()
+
+	if !ok || time.Since(c.loadedAt) > f.ttl {
+		c = cachedLimit{limit: f.limit(token), loadedAt: time.Now()}
+	}
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.limits[token] = c
+	if c.limit > 0 && f.active[token] >= c.limit {
+		return false
+	}
+
+	f.active[token]++
+	return true
+}
+
+func (f *InFlight) Release(token string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	f.active[token]--
+	if f.active[token] <= 0 {
+		delete(f.active, token)
+	}
+}
+
+func (f *InFlight) limit(token string) int {
+	if f.service == nil {
+		return f.defaultLimit
+	}
+
+	limit, err := f.service.GetMaxInFlight(token)
+	if err != nil {
+		return f.defaultLimit
+	}
+
+	return limit
+}
+
+func (f *InFlight) Stop() {
+	f.ticker.Stop()
+	close(f.done)
+}
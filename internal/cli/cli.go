@@ -0,0 +1,138 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Command is run with arguments following its name
+type Command struct {
+	Name  string
+	Args  string
+	Usage string
+	Run   func(c *Client, p Printer, args []string) error
+}
+
+// fileConfig is read from config file, flags and environment variables take precedence over it
+type fileConfig struct {
+	Addr   string `yaml:"addr"`
+	Token  string `yaml:"token"`
+	Output string `yaml:"output"`
+}
+
+// Main parses global flags and runs command given by the first argument. Connection details are taken from flags,
+// then from <NAME>_ADDR, <NAME>_TOKEN and <NAME>_OUTPUT variables, then from <NAME>_CONFIG or ~/.config/<name>.yaml file
+func Main(name, defaultAddr string, commands []Command) {
+	env := strings.ToUpper(name)
+	configName := flag.String("config", "", fmt.Sprintf("config file, %s_CONFIG or ~/.config/%s.yaml by default", env, name))
+	addr := flag.String("addr", "", fmt.Sprintf("admin API address, %s_ADDR or %s by default", env, defaultAddr))
+	token := flag.String("token", "", fmt.Sprintf("admin token, %s_TOKEN by default", env))
+	output := flag.String("output", "", fmt.Sprintf("one of [table, json], %s_OUTPUT or table by default", env))
+	flag.Usage = func() { usage(name, commands) }
+	flag.Parse()
+
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg, err := loadConfig(name, first(*configName, os.Getenv(env+"_CONFIG")))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	p, err := NewPrinter(first(*output, os.Getenv(env+"_OUTPUT"), cfg.Output, OutputTable))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	c := NewClient(
+		first(*addr, os.Getenv(env+"_ADDR"), cfg.Addr, defaultAddr),
+		first(*token, os.Getenv(env+"_TOKEN"), cfg.Token),
+	)
+
+	for _, cmd := range commands {
+		if cmd.Name != flag.Arg(0) {
+			continue
+		}
+
+		if err := cmd.Run(c, p, flag.Args()[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n", flag.Arg(0))
+	flag.Usage()
+	os.Exit(2)
+}
+
+func usage(name string, commands []Command) {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "usage: %s [flags] <command> [command flags] [args]\n", name)
+	fmt.Fprintln(out, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(out, "  %-30s %s\n", cmd.Name+" "+cmd.Args, cmd.Usage)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
+
+// loadConfig reads config file, missing default file means empty config
+func loadConfig(name, filename string) (fileConfig, error) {
+	var cfg fileConfig
+
+	explicit := filename != ""
+	if !explicit {
+		dir, err := os.UserConfigDir()
+		if err != nil {
+			return cfg, nil
+		}
+		filename = filepath.Join(dir, name+".yaml")
+	}
+
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) && !explicit {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("failed to read config: %w", err)
+	}
+
+	if err := yaml.Unmarshal(data, &cfg); err != nil {
+		return cfg, fmt.Errorf("failed to parse config %s: %w", filename, err)
+	}
+
+	return cfg, nil
+}
+
+// first returns the first non-empty value
+func first(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ParseArgs parses command flags and exits when number of positional arguments is not n
+func ParseArgs(fs *flag.FlagSet, args []string, n int, usage string) {
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.TrimSpace("usage: "+filepath.Base(os.Args[0])+" "+fs.Name()+" [flags] "+usage))
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != n {
+		fs.Usage()
+		os.Exit(2)
+	}
+}
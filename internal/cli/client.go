@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned by Call when API responds 404
+	ErrNotFound = errors.New("not found")
+	// ErrConflict is returned by Call when API responds 409
+	ErrConflict = errors.New("conflict")
+)
+
+// Client calls admin API with admin token
+type Client struct {
+	addr  string
+	token string
+	http  *http.Client
+}
+
+func NewClient(addr, token string) *Client {
+	return &Client{addr: strings.TrimRight(addr, "/"), token: token, http: &http.Client{}}
+}
+
+// Do sends request, response is returned whatever its status is
+func (c *Client) Do(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u := c.addr + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", c.addr, err)
+	}
+
+	return resp, nil
+}
+
+// Call sends in as json and decodes response into out, nil in and out mean empty bodies. Statuses other than 2xx are errors
+func (c *Client) Call(method, path string, query url.Values, in, out any) error {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(b)
+		contentType = "application/json"
+	}
+
+	resp, err := c.Do(method, path, query, contentType, body)
+	if err != nil {
+		return err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return ErrNotFound
+	case resp.StatusCode == http.StatusConflict:
+		resp.Body.Close()
+		return ErrConflict
+	case resp.StatusCode/100 != 2:
+		return APIError(resp)
+	}
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// APIError describes unexpected response and closes its body
+func APIError(resp *http.Response) error {
+	defer resp.Body.Close()
+
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if len(msg) == 0 {
+		return fmt.Errorf("server responded %s", resp.Status)
+	}
+
+	return fmt.Errorf("server responded %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
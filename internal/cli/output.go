@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	OutputTable = "table"
+	OutputJSON  = "json"
+)
+
+// Printer prints command results either as aligned table or as json of the API response
+type Printer struct {
+	JSON bool
+}
+
+func NewPrinter(output string) (Printer, error) {
+	switch output {
+	case OutputTable:
+		return Printer{}, nil
+	case OutputJSON:
+		return Printer{JSON: true}, nil
+	default:
+		return Printer{}, fmt.Errorf("unknown output %q", output)
+	}
+}
+
+// Print writes v as json or header with rows as table
+func (p Printer) Print(v any, header []string, rows [][]string) error {
+	if p.JSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, strings.Join(header, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+// Message prints result of command which has no payload
+func (p Printer) Message(format string, args ...any) {
+	if p.JSON {
+		return
+	}
+	fmt.Printf(format+"\n", args...)
+}
+
+// CellString returns value of table cell, nil values are shown as dash
+func CellString(v *string) string {
+	if v == nil {
+		return "-"
+	}
+	return *v
+}
+
+func CellInt(v *int) string {
+	if v == nil {
+		return "-"
+	}
+	return strconv.Itoa(*v)
+}
+
+func CellTime(v *time.Time) string {
+	if v == nil {
+		return "-"
+	}
+	return v.Format(time.RFC3339)
+}
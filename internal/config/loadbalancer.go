@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -9,11 +10,89 @@ import (
 	"gopkg.in/yaml.v2"
 )
 
+const (
+	StorageMemory   = "memory"
+	StoragePostgres = "postgres"
+)
+
+// EdgeLimiter runs rate limiter in front of load balancer. Storage is one of [memory, postgres],
+// memory storage keeps limits and quotas in the process only. Token port serves admin API of postgres storage, 0 disables it
+type EdgeLimiter struct {
+	Enabled      bool   `yaml:"enabled"`
+	Storage      string `yaml:"storage"`
+	MigrationDir string `yaml:"migration_dir"`
+	TokenPort    int    `yaml:"token_port"`
+	Admin        Admin  `yaml:"admin"`
+	Limiter      `yaml:",inline"`
+	DBParam      `yaml:"-"`
+}
+
+// SlowStart ramps weight of recovered or added server linearly from MinWeight up to full within Window, 0 window disables it
+type SlowStart struct {
+	Window    time.Duration `yaml:"window"`
+	MinWeight float64       `yaml:"min_weight"`
+}
+
+// CircuitBreaker stops sending requests to server when ErrorRate of requests within Window failed
+// or SlowRate of them took longer than SlowThreshold. After OpenTimeout HalfOpenProbes requests are let through,
+// circuit is closed when all of them succeed. 0 slow threshold disables latency check
+type CircuitBreaker struct {
+	Enabled        bool          `yaml:"enabled"`
+	Window         time.Duration `yaml:"window"`
+	MinRequests    int           `yaml:"min_requests"`
+	ErrorRate      float64       `yaml:"error_rate"`
+	SlowThreshold  time.Duration `yaml:"slow_threshold"`
+	SlowRate       float64       `yaml:"slow_rate"`
+	OpenTimeout    time.Duration `yaml:"open_timeout"`
+	HalfOpenProbes int           `yaml:"half_open_probes"`
+}
+
+func (cfg *CircuitBreaker) setDefaults() error {
+	if cfg.Window == 0 {
+		cfg.Window = 10 * time.Second
+	}
+	if cfg.MinRequests == 0 {
+		cfg.MinRequests = 20
+	}
+	if cfg.ErrorRate == 0 {
+		cfg.ErrorRate = 0.5
+	}
+	if cfg.SlowRate == 0 {
+		cfg.SlowRate = 0.5
+	}
+	if cfg.OpenTimeout == 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenProbes == 0 {
+		cfg.HalfOpenProbes = 3
+	}
+
+	if cfg.ErrorRate < 0 || cfg.ErrorRate > 1 || cfg.SlowRate < 0 || cfg.SlowRate > 1 {
+		return errors.New("circuit breaker rates must be within (0, 1]")
+	}
+	if cfg.Window < 0 || cfg.OpenTimeout < 0 || cfg.SlowThreshold < 0 || cfg.MinRequests < 0 || cfg.HalfOpenProbes < 0 {
+		return errors.New("circuit breaker settings must not be negative")
+	}
+	if cfg.Window < time.Second {
+		// window is split into buckets, too short one leaves them empty
+		return errors.New("circuit breaker window must be at least 1s")
+	}
+
+	return nil
+}
+
+// LoadBalancer admin API is served on AdminPort, 0 disables it
 type LoadBalancer struct {
-	Port                int           `yaml:"port"`
-	Algorithm           pool.Algo     `yaml:"algorithm"`
-	HealthCheckInterval time.Duration `yaml:"health_check_interval"`
-	Servers             []string      `yaml:"servers"`
+	Port                int            `yaml:"port"`
+	AdminPort           int            `yaml:"admin_port"`
+	Admin               Admin          `yaml:"admin"`
+	Algorithm           pool.Algo      `yaml:"algorithm"`
+	HealthCheckInterval time.Duration  `yaml:"health_check_interval"`
+	DrainTimeout        time.Duration  `yaml:"drain_timeout"`
+	SlowStart           SlowStart      `yaml:"slow_start"`
+	CircuitBreaker      CircuitBreaker `yaml:"circuit_breaker"`
+	Servers             []string       `yaml:"servers"`
+	RateLimiter         EdgeLimiter    `yaml:"rate_limiter"`
 }
 
 func LoadConfigLoadBalancer(filename string) (*LoadBalancer, error) {
@@ -30,9 +109,48 @@ func LoadConfigLoadBalancer(filename string) (*LoadBalancer, error) {
 	if cfg.HealthCheckInterval == 0 {
 		cfg.HealthCheckInterval = 10 * time.Second
 	}
+	if cfg.DrainTimeout == 0 {
+		cfg.DrainTimeout = 30 * time.Second
+	}
+	if cfg.SlowStart.MinWeight == 0 {
+		cfg.SlowStart.MinWeight = 0.1
+	}
+	if cfg.SlowStart.MinWeight < 0 || cfg.SlowStart.MinWeight > 1 {
+		return nil, errors.New("slow start min weight must be within (0, 1]")
+	}
+	if cfg.CircuitBreaker.Enabled {
+		if err := cfg.CircuitBreaker.setDefaults(); err != nil {
+			return nil, err
+		}
+	}
 	if cfg.Algorithm == pool.Undefined {
 		cfg.Algorithm = pool.RoundRobin
 	}
 
+	if cfg.AdminPort != 0 {
+		if err := cfg.Admin.setDefaults(); err != nil {
+			return nil, err
+		}
+	}
+
+	if cfg.RateLimiter.Enabled {
+		if err := cfg.RateLimiter.setDefaults(); err != nil {
+			return nil, err
+		}
+
+		switch cfg.RateLimiter.Storage {
+		case "":
+			cfg.RateLimiter.Storage = StorageMemory
+		case StorageMemory:
+		case StoragePostgres:
+			if err := cfg.RateLimiter.Admin.setDefaults(); err != nil {
+				return nil, err
+			}
+			cfg.RateLimiter.DBParam = loadDBParam()
+		default:
+			return nil, fmt.Errorf("unexpected rate limiter storage '%s'", cfg.RateLimiter.Storage)
+		}
+	}
+
 	return &cfg, nil
 }
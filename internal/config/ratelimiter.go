@@ -1,6 +1,7 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"time"
@@ -20,13 +21,169 @@ func (p *DBParam) GetConnStr() string {
 	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable", p.DBUser, p.DBPassword, p.DBHost, p.DBPort, p.DBName)
 }
 
+// KeyExtractor describes how rate limit key is taken from request.
+// Type is one of [header, ip, jwt, path, composite]
+type KeyExtractor struct {
+	Type           string         `yaml:"type"`
+	Header         string         `yaml:"header"`
+	Claim          string         `yaml:"claim"`
+	SecretEnv      string         `yaml:"secret_env"`
+	TrustedProxies []string       `yaml:"trusted_proxies"`
+	Prefix         string         `yaml:"prefix"`
+	Parts          []KeyExtractor `yaml:"parts"`
+}
+
+// Cost describes how many tokens request takes. Default cost is 1,
+// Header names upstream response header with the actual cost debited after the fact
+type Cost struct {
+	Default int            `yaml:"default"`
+	Methods map[string]int `yaml:"methods"`
+	PerKB   int            `yaml:"per_kb"`
+	Header  string         `yaml:"header"`
+}
+
+func (cfg Cost) validate() error {
+	if cfg.Default < 0 {
+		return errors.New("default cost must not be negative")
+	}
+	for method, cost := range cfg.Methods {
+		if cost < 1 {
+			return fmt.Errorf("cost of method %s must be at least 1", method)
+		}
+	}
+	if cfg.PerKB < 0 {
+		return errors.New("cost per kb must not be negative")
+	}
+
+	return nil
+}
+
+// Queue delays up to Size requests per key for at most MaxWait instead of rejecting them
+type Queue struct {
+	Size    int           `yaml:"size"`
+	MaxWait time.Duration `yaml:"max_wait"`
+}
+
+// Access holds static allow and deny lists of API keys and IP CIDRs,
+// database lists are reloaded every RefreshInterval
+type Access struct {
+	TrustedProxies  []string      `yaml:"trusted_proxies"`
+	Allow           []string      `yaml:"allow"`
+	Deny            []string      `yaml:"deny"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// Penalty bans keys which get more than Threshold rejections within Window.
+// Ban doubles in a row up to MaxBan and the row is reset after ResetAfter, zero threshold disables bans
+type Penalty struct {
+	Threshold       int           `yaml:"threshold"`
+	Window          time.Duration `yaml:"window"`
+	Ban             time.Duration `yaml:"ban"`
+	MaxBan          time.Duration `yaml:"max_ban"`
+	ResetAfter      time.Duration `yaml:"reset_after"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// Quota limits usage per day and month next to the bucket, zero default means no limit.
+// Usage is stored every FlushInterval
+type Quota struct {
+	DefaultDaily   int64         `yaml:"default_daily"`
+	DefaultMonthly int64         `yaml:"default_monthly"`
+	FlushInterval  time.Duration `yaml:"flush_interval"`
+}
+
+// Usage is written to storage every FlushInterval
+type Usage struct {
+	FlushInterval time.Duration `yaml:"flush_interval"`
+}
+
+// Upstream is a list of servers allowed requests are proxied to in round-robin order.
+// RequestTimeout bounds the whole upstream call, zero health check interval disables health checks
+type Upstream struct {
+	Servers               []string      `yaml:"servers"`
+	PreserveHost          bool          `yaml:"preserve_host"`
+	DialTimeout           time.Duration `yaml:"dial_timeout"`
+	ResponseHeaderTimeout time.Duration `yaml:"response_header_timeout"`
+	RequestTimeout        time.Duration `yaml:"request_timeout"`
+	IdleTimeout           time.Duration `yaml:"idle_timeout"`
+	HealthCheckInterval   time.Duration `yaml:"health_check_interval"`
+}
+
+// Admin protects token API. Token with write scope is taken from BootstrapTokenEnv variable.
+// When TLS is enabled client certificates signed by ClientCA are mapped to scopes by common name
+type Admin struct {
+	BootstrapTokenEnv string            `yaml:"bootstrap_token_env"`
+	TLSCert           string            `yaml:"tls_cert"`
+	TLSKey            string            `yaml:"tls_key"`
+	ClientCA          string            `yaml:"client_ca"`
+	CertScopes        map[string]string `yaml:"cert_scopes"`
+}
+
+func (cfg *Admin) setDefaults() error {
+	if cfg.BootstrapTokenEnv == "" {
+		cfg.BootstrapTokenEnv = "ADMIN_TOKEN"
+	}
+	if (cfg.TLSCert == "") != (cfg.TLSKey == "") {
+		return errors.New("admin tls requires both certificate and key")
+	}
+	if cfg.ClientCA != "" && cfg.TLSCert == "" {
+		return errors.New("admin client certificates require tls")
+	}
+
+	return nil
+}
+
+// Rule limits requests matching methods and path with its own capacity and key.
+// Empty interval and key are inherited from the global settings.
+// GlobalCapacity is a ceiling shared by all tokens of the rule, requests also count against the global one.
+// Mode is one of [enforce, shadow], shadow rules never reject requests
+type Rule struct {
+	Name           string         `yaml:"name"`
+	Mode           string         `yaml:"mode"`
+	Methods        []string       `yaml:"methods"`
+	PathPrefix     string         `yaml:"path_prefix"`
+	PathRegex      string         `yaml:"path_regex"`
+	Capacity       int            `yaml:"capacity"`
+	GlobalCapacity int            `yaml:"global_capacity"`
+	Interval       time.Duration  `yaml:"interval"`
+	Key            []KeyExtractor `yaml:"key"`
+	Cost           Cost           `yaml:"cost"`
+	MaxInFlight    int            `yaml:"max_in_flight"`
+	Queue          Queue          `yaml:"queue"`
+}
+
+// Limiter holds rate limiting settings shared by rate limiter and load balancer
+type Limiter struct {
+	Interval        time.Duration  `yaml:"interval"`
+	DefaultCapacity int            `yaml:"default_capacity"`
+	GlobalCapacity  int            `yaml:"global_capacity"`
+	MaxInFlight     int            `yaml:"default_max_in_flight"`
+	Key             []KeyExtractor `yaml:"key"`
+	Cost            Cost           `yaml:"cost"`
+	Queue           Queue          `yaml:"queue"`
+	Mode            string         `yaml:"mode"`
+	Rules           []Rule         `yaml:"rules"`
+	Access          Access         `yaml:"access"`
+	Penalty         Penalty        `yaml:"penalty"`
+	Quota           Quota          `yaml:"quota"`
+	Usage           Usage          `yaml:"usage"`
+	Timezone        string         `yaml:"timezone"`
+	KeyHashEnv      string         `yaml:"key_hash_secret_env"`
+	KeyCacheTTL     time.Duration  `yaml:"key_cache_ttl"`
+	RequireIssued   bool           `yaml:"require_issued_keys"`
+	Location        *time.Location `yaml:"-"`
+}
+
 type RateLimiter struct {
-	Port            int           `yaml:"port"`
-	TokenPort       int           `yaml:"token_port"`
-	MigrationDir    string        `yaml:"migration_dir"`
-	Interval        time.Duration `yaml:"interval"`
-	DefaultCapacity int           `yaml:"default_capacity"`
-	DBParam         `yaml:"-"`
+	Port         int      `yaml:"port"`
+	Upstream     Upstream `yaml:"upstream"`
+	TokenPort    int      `yaml:"token_port"`
+	DecisionPort int      `yaml:"decision_port"`
+	DecisionHost string   `yaml:"decision_host"`
+	Admin        Admin    `yaml:"admin"`
+	MigrationDir string   `yaml:"migration_dir"`
+	Limiter      `yaml:",inline"`
+	DBParam      `yaml:"-"`
 }
 
 func LoadConfigRateLimiter(filename string) (*RateLimiter, error) {
@@ -40,11 +197,101 @@ func LoadConfigRateLimiter(filename string) (*RateLimiter, error) {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
 
-	cfg.DBPassword = os.Getenv("DATABASE_PASSWORD")
-	cfg.DBUser = os.Getenv("DATABASE_USER")
-	cfg.DBHost = os.Getenv("DATABASE_HOST")
-	cfg.DBPort = os.Getenv("DATABASE_PORT")
-	cfg.DBName = os.Getenv("DATABASE_NAME")
+	if err := cfg.Limiter.setDefaults(); err != nil {
+		return nil, err
+	}
+	if err := cfg.Admin.setDefaults(); err != nil {
+		return nil, err
+	}
+	if len(cfg.Upstream.Servers) == 0 {
+		return nil, errors.New("no upstream servers configured")
+	}
+	if cfg.DecisionHost == "" {
+		cfg.DecisionHost = "127.0.0.1"
+	}
+	if cfg.Upstream.DialTimeout == 0 {
+		cfg.Upstream.DialTimeout = 5 * time.Second
+	}
+	if cfg.Upstream.IdleTimeout == 0 {
+		cfg.Upstream.IdleTimeout = 90 * time.Second
+	}
+
+	cfg.DBParam = loadDBParam()
 
 	return &cfg, nil
 }
+
+func loadDBParam() DBParam {
+	return DBParam{
+		DBPassword: os.Getenv("DATABASE_PASSWORD"),
+		DBUser:     os.Getenv("DATABASE_USER"),
+		DBHost:     os.Getenv("DATABASE_HOST"),
+		DBPort:     os.Getenv("DATABASE_PORT"),
+		DBName:     os.Getenv("DATABASE_NAME"),
+	}
+}
+
+func (cfg *Limiter) setDefaults() error {
+	var err error
+	if cfg.Interval == 0 {
+		cfg.Interval = time.Minute
+	}
+	if cfg.Location, err = time.LoadLocation(cfg.Timezone); err != nil {
+		return fmt.Errorf("failed to load timezone: %w", err)
+	}
+	if cfg.KeyHashEnv == "" {
+		cfg.KeyHashEnv = "TOKEN_HASH_SECRET"
+	}
+	if cfg.KeyCacheTTL == 0 {
+		cfg.KeyCacheTTL = 30 * time.Second
+	}
+	if cfg.Access.RefreshInterval == 0 {
+		cfg.Access.RefreshInterval = 30 * time.Second
+	}
+	if cfg.Penalty.Window == 0 {
+		cfg.Penalty.Window = time.Minute
+	}
+	if cfg.Penalty.Ban == 0 {
+		cfg.Penalty.Ban = time.Minute
+	}
+	if cfg.Penalty.MaxBan < cfg.Penalty.Ban {
+		cfg.Penalty.MaxBan = 24 * time.Hour
+	}
+	if cfg.Penalty.ResetAfter == 0 {
+		cfg.Penalty.ResetAfter = 24 * time.Hour
+	}
+	if cfg.Penalty.RefreshInterval == 0 {
+		cfg.Penalty.RefreshInterval = 30 * time.Second
+	}
+	if cfg.Quota.FlushInterval == 0 {
+		cfg.Quota.FlushInterval = 10 * time.Second
+	}
+	if cfg.Usage.FlushInterval == 0 {
+		cfg.Usage.FlushInterval = 10 * time.Second
+	}
+	if cfg.Queue.MaxWait == 0 {
+		cfg.Queue.MaxWait = cfg.Interval
+	}
+	if err := cfg.Cost.validate(); err != nil {
+		return err
+	}
+	for i := range cfg.Rules {
+		if cfg.Rules[i].Name == "" {
+			cfg.Rules[i].Name = fmt.Sprintf("rule-%d", i)
+		}
+		if cfg.Rules[i].Interval == 0 {
+			cfg.Rules[i].Interval = cfg.Interval
+		}
+		if cfg.Rules[i].Queue.MaxWait == 0 {
+			cfg.Rules[i].Queue.MaxWait = cfg.Rules[i].Interval
+		}
+		if cfg.Rules[i].Capacity < 0 {
+			return fmt.Errorf("rule '%s' has negative capacity", cfg.Rules[i].Name)
+		}
+		if err := cfg.Rules[i].Cost.validate(); err != nil {
+			return fmt.Errorf("rule '%s': %w", cfg.Rules[i].Name, err)
+		}
+	}
+
+	return nil
+}
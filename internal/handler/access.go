@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Arzeeq/cloud-camp/internal/access"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type AccessServicer interface {
+	ListEntries() ([]model.AccessEntry, error)
+	AddEntry(e model.AccessEntry) (model.AccessEntry, error)
+	DeleteEntry(id int64) error
+}
+
+type AccessHandler struct {
+	service AccessServicer
+	hasher  KeyHasher
+	l       *slog.Logger
+}
+
+func NewAccessHandler(service AccessServicer, hasher KeyHasher, l *slog.Logger) *AccessHandler {
+	return &AccessHandler{service: service, hasher: hasher, l: l}
+}
+
+func (h *AccessHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /access", h.ListEntries)
+	mux.HandleFunc("POST /access", h.AddEntry)
+	mux.HandleFunc("DELETE /access/{id}", h.DeleteEntry)
+}
+
+func (h *AccessHandler) ListEntries(w http.ResponseWriter, r *http.Request) {
+	entries, err := h.service.ListEntries()
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to list access entries: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []model.AccessEntry{}
+	}
+	writeJSON(w, h.l, http.StatusOK, entries)
+}
+
+// AddEntry adds API key or IP CIDR to allow or deny list, entry with expiry is a temporary one
+func (h *AccessHandler) AddEntry(w http.ResponseWriter, r *http.Request) {
+	var e model.AccessEntry
+	if err := parse(r.Body, &e); err != nil || e.Entry == "" || (e.List != model.ListAllow && e.List != model.ListDeny) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	// IP is stored as a single address CIDR so all entries of network kind look the same, keys are stored hashed
+	n, err := access.ParseNetwork(e.Entry)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	if n != nil {
+		e.Entry = n.String()
+	} else {
+		e.Entry = h.hasher.Hash(e.Entry)
+	}
+
+	e, err = h.service.AddEntry(e)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to add access entry: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusOK, e)
+}
+
+func (h *AccessHandler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err = h.service.DeleteEntry(id)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to delete access entry: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
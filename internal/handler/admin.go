@@ -0,0 +1,138 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type adminTokenDTO struct {
+	model.AdminToken
+	Token string `json:"token"`
+}
+
+type AdminServicer interface {
+	ListAdminTokens() ([]model.AdminToken, error)
+	AddAdminToken(actor string, t model.AdminToken, hash string) (model.AdminToken, error)
+	DeleteAdminToken(actor string, id int64) error
+	ListAudit(targets []string, limit uint64) ([]model.AuditEntry, error)
+}
+
+type AdminHandler struct {
+	service AdminServicer
+	hasher  KeyHasher
+	l       *slog.Logger
+}
+
+func NewAdminHandler(service AdminServicer, hasher KeyHasher, l *slog.Logger) *AdminHandler {
+	return &AdminHandler{service: service, hasher: hasher, l: l}
+}
+
+func (h *AdminHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /admin/tokens", h.ListAdminTokens)
+	mux.HandleFunc("POST /admin/tokens", h.AddAdminToken)
+	mux.HandleFunc("DELETE /admin/tokens/{id}", h.DeleteAdminToken)
+	mux.HandleFunc("GET /audit", h.ListAudit)
+}
+
+func (h *AdminHandler) ListAdminTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := h.service.ListAdminTokens()
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to list admin tokens: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if tokens == nil {
+		tokens = []model.AdminToken{}
+	}
+	writeJSON(w, h.l, http.StatusOK, tokens)
+}
+
+// AddAdminToken generates new token, it is returned only once and only its hash is stored
+func (h *AdminHandler) AddAdminToken(w http.ResponseWriter, r *http.Request) {
+	var t model.AdminToken
+	if err := parse(r.Body, &t); err != nil || t.Name == "" || (t.Scope != model.ScopeRead && t.Scope != model.ScopeWrite) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	token, err := auth.GenerateToken()
+	if err != nil {
+		h.l.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	t, err = h.service.AddAdminToken(auth.Actor(r.Context()), t, auth.HashToken(token))
+	if errors.Is(err, model.ErrConflict) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to add admin token: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusCreated, adminTokenDTO{AdminToken: t, Token: token})
+}
+
+func (h *AdminHandler) DeleteAdminToken(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err = h.service.DeleteAdminToken(auth.Actor(r.Context()), id)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to delete admin token: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// ListAudit returns the latest changes, optionally of a single target. Limit is 100 by default.
+// Keys are audited by their hashes while tenants and admin tokens are audited by names, so target matches both
+func (h *AdminHandler) ListAudit(w http.ResponseWriter, r *http.Request) {
+	limit := uint64(100)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.ParseUint(v, 10, 64); err != nil || limit == 0 || limit > 1000 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("failed to parse request parameters"))
+			return
+		}
+	}
+
+	var targets []string
+	if target := r.URL.Query().Get("target"); target != "" {
+		targets = []string{target, h.hasher.Hash(target)}
+	}
+
+	entries, err := h.service.ListAudit(targets, limit)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to list audit log: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if entries == nil {
+		entries = []model.AuditEntry{}
+	}
+	writeJSON(w, h.l, http.StatusOK, entries)
+}
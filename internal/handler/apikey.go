@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/apikey"
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type rotateDTO struct {
+	Overlap   string     `json:"overlap"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+// CreateKey issues new key, the key is returned only once and only its hash is stored
+func (h *TokenHandler) CreateKey(w http.ResponseWriter, r *http.Request) {
+	var k model.APIKey
+	if err := parse(r.Body, &k); err != nil || k.Capacity < 0 || (k.ExpiresAt != nil && !k.ExpiresAt.After(time.Now())) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+	k.RevokedAt = nil
+
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		h.l.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	k.Prefix = prefix
+
+	k, err = h.service.CreateKey(auth.Actor(r.Context()), h.hasher.Hash(key), k)
+	if errors.Is(err, model.ErrConflict) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to create key: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	k.Key = key
+	writeJSON(w, h.l, http.StatusCreated, k)
+}
+
+func (h *TokenHandler) GetKey(w http.ResponseWriter, r *http.Request) {
+	k, err := h.service.GetKey(r.PathValue("prefix"))
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to get key: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusOK, k)
+}
+
+// RotateKey issues new key with settings of the old one, the old key keeps working for overlap
+func (h *TokenHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	var d rotateDTO
+	if err := parse(r.Body, &d); err != nil || (d.ExpiresAt != nil && !d.ExpiresAt.After(time.Now())) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	var overlap time.Duration
+	if d.Overlap != "" {
+		var err error
+		if overlap, err = time.ParseDuration(d.Overlap); err != nil || overlap < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("failed to parse overlap"))
+			return
+		}
+	}
+
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		h.l.Error(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	k := model.APIKey{Prefix: prefix, ExpiresAt: d.ExpiresAt}
+	k, err = h.service.RotateKey(auth.Actor(r.Context()), r.PathValue("prefix"), h.hasher.Hash(key), k, overlap)
+	switch {
+	case errors.Is(err, model.ErrNotFound):
+		w.WriteHeader(http.StatusNotFound)
+		return
+	case errors.Is(err, model.ErrKeyExpired), errors.Is(err, model.ErrKeyRevoked):
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(err.Error()))
+		return
+	case errors.Is(err, model.ErrConflict):
+		w.WriteHeader(http.StatusConflict)
+		return
+	case err != nil:
+		h.l.Error(fmt.Sprintf("Failed to rotate key: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	k.Key = key
+	writeJSON(w, h.l, http.StatusCreated, k)
+}
+
+func (h *TokenHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	err := h.service.RevokeKey(auth.Actor(r.Context()), r.PathValue("prefix"))
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to revoke key: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,324 @@
+package handler
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+const (
+	// maxImportBytes and maxImportRows bound memory taken by import, rows are validated before anything is stored
+	maxImportBytes = 64 << 20
+	maxImportRows  = 200_000
+)
+
+var contentTypes = map[string]string{
+	model.FormatCSV:    "text/csv",
+	model.FormatJSON:   "application/json",
+	model.FormatNDJSON: "application/x-ndjson",
+}
+
+// ImportCapacities sets capacities of all rows in one transaction. Format is taken from format parameter
+// or content type, nothing is imported when any row is invalid or dry_run is set. Larger imports must be split
+func (h *TokenHandler) ImportCapacities(w http.ResponseWriter, r *http.Request) {
+	format := importFormat(r)
+	dryRun, err := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+	if _, ok := contentTypes[format]; !ok || (err != nil && r.URL.Query().Has("dry_run")) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	report := model.ImportReport{DryRun: dryRun, Errors: []model.RowError{}}
+	var rows []model.TokenRow
+	seen := make(map[string]int)
+	body := http.MaxBytesReader(w, r.Body, maxImportBytes)
+	err = readRows(format, body, func(n int, row model.TokenRow, err error) {
+		report.Rows++
+		if report.Rows > maxImportRows {
+			return
+		}
+		if err == nil {
+			row, err = h.prepareRow(row)
+		}
+		if first, ok := seen[row.TokenHash]; err == nil && ok {
+			err = fmt.Errorf("token is already imported by row %d", first)
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, model.RowError{Row: n, Error: err.Error()})
+			return
+		}
+
+		seen[row.TokenHash] = n
+		rows = append(rows, row)
+	})
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) || report.Rows > maxImportRows {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write([]byte(fmt.Sprintf("import is limited to %d rows and %d bytes", maxImportRows, maxImportBytes)))
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	if len(report.Errors) > 0 {
+		writeJSON(w, h.l, http.StatusUnprocessableEntity, report)
+		return
+	}
+	if dryRun || len(rows) == 0 {
+		writeJSON(w, h.l, http.StatusOK, report)
+		return
+	}
+
+	report.Imported, err = h.service.ImportCapacities(auth.Actor(r.Context()), rows)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to import capacities: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusOK, report)
+}
+
+// ExportTokens streams all stored tokens in format given by format parameter, ndjson by default
+func (h *TokenHandler) ExportTokens(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = model.FormatNDJSON
+	}
+	contentType, ok := contentTypes[format]
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	w.Header().Add("Content-Type", contentType)
+	write, flush := recordWriter(format, w)
+
+	if err := h.service.ExportTokens(write); err != nil {
+		// status is already sent with the first row, client sees truncated body
+		h.l.Error(fmt.Sprintf("Failed to export tokens: %v", err.Error()))
+		return
+	}
+
+	if err := flush(); err != nil {
+		h.l.Error(fmt.Sprintf("Failed to export tokens: %v", err.Error()))
+	}
+}
+
+func importFormat(r *http.Request) string {
+	if format := r.URL.Query().Get("format"); format != "" {
+		return format
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	for format, contentType := range contentTypes {
+		if mediaType == contentType {
+			return format
+		}
+	}
+
+	return model.FormatJSON
+}
+
+// prepareRow validates row and replaces its raw token with hash
+func (h *TokenHandler) prepareRow(row model.TokenRow) (model.TokenRow, error) {
+	switch {
+	case row.Token != "" && row.TokenHash != "":
+		return row, errors.New("only one of token and token_hash must be set")
+	case row.Token != "":
+		row.TokenHash = h.hasher.Hash(row.Token)
+		row.Token = ""
+	case row.TokenHash == "":
+		return row, errors.New("token or token_hash must be set")
+	default:
+		if b, err := hex.DecodeString(row.TokenHash); err != nil || len(b) != 32 || strings.ToLower(row.TokenHash) != row.TokenHash {
+			return row, errors.New("token_hash must be 64 lowercase hex characters")
+		}
+	}
+
+	if row.Capacity < 0 {
+		return row, errors.New("capacity must not be negative")
+	}
+
+	return row, nil
+}
+
+// readRows calls fn for every row of body, rows which can not be decoded are passed with error.
+// Error is returned when body is malformed so rows can not be told apart
+func readRows(format string, body io.Reader, fn func(n int, row model.TokenRow, err error)) error {
+	switch format {
+	case model.FormatCSV:
+		return readCSV(body, fn)
+	case model.FormatNDJSON:
+		s := bufio.NewScanner(body)
+		s.Buffer(make([]byte, 64*1024), 1024*1024)
+		n := 0
+		for s.Scan() {
+			line := strings.TrimSpace(s.Text())
+			if line == "" {
+				continue
+			}
+
+			n++
+			var row model.TokenRow
+			fn(n, row, json.Unmarshal([]byte(line), &row))
+		}
+		if err := s.Err(); err != nil {
+			return fmt.Errorf("failed to read rows: %w", err)
+		}
+	default:
+		dec := json.NewDecoder(body)
+		if tok, err := dec.Token(); err != nil || tok != json.Delim('[') {
+			return errors.New("rows must be a json array")
+		}
+		for n := 1; dec.More(); n++ {
+			var raw json.RawMessage
+			if err := dec.Decode(&raw); err != nil {
+				return fmt.Errorf("failed to read row %d: %w", n, err)
+			}
+
+			var row model.TokenRow
+			fn(n, row, json.Unmarshal(raw, &row))
+		}
+		if _, err := dec.Token(); err != nil {
+			return fmt.Errorf("failed to read rows: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// readCSV reads rows with header naming token or token_hash and capacity columns, other columns are ignored
+func readCSV(body io.Reader, fn func(n int, row model.TokenRow, err error)) error {
+	cr := csv.NewReader(body)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read csv header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["capacity"]; !ok {
+		return errors.New("csv header must have capacity column")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	for n := 1; ; n++ {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			if errors.Is(err, csv.ErrFieldCount) {
+				fn(n, model.TokenRow{}, errors.New("wrong number of fields"))
+				continue
+			}
+			return fmt.Errorf("failed to read row %d: %w", n, err)
+		}
+
+		row := model.TokenRow{Token: field(record, "token"), TokenHash: field(record, "token_hash")}
+		row.Capacity, err = strconv.Atoi(field(record, "capacity"))
+		if err != nil {
+			err = errors.New("capacity must be an integer")
+		}
+		fn(n, row, err)
+	}
+}
+
+// recordWriter returns function writing exported record and function finishing the export
+func recordWriter(format string, w io.Writer) (func(model.TokenRecord) error, func() error) {
+	switch format {
+	case model.FormatCSV:
+		cw := csv.NewWriter(w)
+		header := false
+		write := func(t model.TokenRecord) error {
+			if !header {
+				header = true
+				if err := cw.Write(recordColumns); err != nil {
+					return err
+				}
+			}
+			return cw.Write(csvRecord(t))
+		}
+		flush := func() error {
+			if !header {
+				cw.Write(recordColumns)
+			}
+			cw.Flush()
+			return cw.Error()
+		}
+		return write, flush
+	case model.FormatJSON:
+		enc := json.NewEncoder(w)
+		first := true
+		write := func(t model.TokenRecord) error {
+			sep := ","
+			if first {
+				sep, first = "[", false
+			}
+			if _, err := io.WriteString(w, sep); err != nil {
+				return err
+			}
+			return enc.Encode(t)
+		}
+		flush := func() error {
+			end := "]\n"
+			if first {
+				end = "[]\n"
+			}
+			_, err := io.WriteString(w, end)
+			return err
+		}
+		return write, flush
+	default:
+		enc := json.NewEncoder(w)
+		return func(t model.TokenRecord) error { return enc.Encode(t) }, func() error { return nil }
+	}
+}
+
+var recordColumns = []string{"token_hash", "key_prefix", "capacity", "tenant", "max_in_flight", "expires_at", "revoked_at"}
+
+func csvRecord(t model.TokenRecord) []string {
+	record := []string{t.TokenHash, t.KeyPrefix, strconv.Itoa(t.Capacity), "", "", "", ""}
+	if t.Tenant != nil {
+		record[3] = *t.Tenant
+	}
+	if t.MaxInFlight != nil {
+		record[4] = strconv.Itoa(*t.MaxInFlight)
+	}
+	if t.ExpiresAt != nil {
+		record[5] = t.ExpiresAt.Format(time.RFC3339)
+	}
+	if t.RevokedAt != nil {
+		record[6] = t.RevokedAt.Format(time.RFC3339)
+	}
+
+	return record
+}
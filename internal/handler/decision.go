@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/Arzeeq/cloud-camp/internal/ratelimiter"
+)
+
+type decisionRequestDTO struct {
+	Domain      string                   `json:"domain"`
+	Descriptors []ratelimiter.Descriptor `json:"descriptors"`
+}
+
+type decisionResponseDTO struct {
+	OverallCode string               `json:"overall_code"`
+	Statuses    []ratelimiter.Status `json:"statuses"`
+}
+
+type Decider interface {
+	Decide(d ratelimiter.Descriptor) ratelimiter.Status
+}
+
+// DecisionHandler lets external proxies ask rate limiter for decisions
+type DecisionHandler struct {
+	decider Decider
+	l       *slog.Logger
+}
+
+func NewDecisionHandler(decider Decider, l *slog.Logger) *DecisionHandler {
+	return &DecisionHandler{decider: decider, l: l}
+}
+
+func (h *DecisionHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /v1/ratelimit", h.ShouldRateLimit)
+	mux.HandleFunc("GET /v1/auth", h.Auth)
+}
+
+// ShouldRateLimit decides for every descriptor, overall code is OVER_LIMIT if any of them is over limit
+func (h *DecisionHandler) ShouldRateLimit(w http.ResponseWriter, r *http.Request) {
+	var d decisionRequestDTO
+	if err := parse(r.Body, &d); err != nil || len(d.Descriptors) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	for _, descriptor := range d.Descriptors {
+		if descriptor.Key == "" || descriptor.Cost < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("failed to parse request parameters"))
+			return
+		}
+	}
+
+	res := decisionResponseDTO{
+		OverallCode: ratelimiter.CodeOK,
+		Statuses:    make([]ratelimiter.Status, 0, len(d.Descriptors)),
+	}
+	for _, descriptor := range d.Descriptors {
+		status := h.decider.Decide(descriptor)
+		if status.Code == ratelimiter.CodeOverLimit {
+			res.OverallCode = ratelimiter.CodeOverLimit
+		}
+		res.Statuses = append(res.Statuses, status)
+	}
+
+	writeJSON(w, h.l, http.StatusOK, res)
+}
+
+// Auth serves nginx auth_request, descriptor is taken from X-RateLimit-Key, X-RateLimit-Key-Type, X-Original-Method,
+// X-Original-URI and X-RateLimit-Cost headers. Allowed request gets 204 and rejected one gets 403
+func (h *DecisionHandler) Auth(w http.ResponseWriter, r *http.Request) {
+	d := ratelimiter.Descriptor{
+		Key:     r.Header.Get("X-RateLimit-Key"),
+		KeyType: r.Header.Get("X-RateLimit-Key-Type"),
+		Route:   r.Header.Get("X-Original-URI"),
+		Method:  r.Header.Get("X-Original-Method"),
+	}
+	if cost := r.Header.Get("X-RateLimit-Cost"); cost != "" {
+		var err error
+		if d.Cost, err = strconv.Atoi(cost); err != nil || d.Cost < 0 {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("failed to parse request parameters"))
+			return
+		}
+	}
+	if d.Key == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	status := h.decider.Decide(d)
+	if status.Remaining >= 0 {
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	}
+	if status.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(status.RetryAfter))
+	}
+
+	if status.Code == ratelimiter.CodeOverLimit {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,10 +2,15 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
 )
 
 type dto struct {
@@ -13,17 +18,74 @@ type dto struct {
 	Capacity int    `json:"capacity"`
 }
 
+type tenantDTO struct {
+	Tenant   string `json:"tenant"`
+	Capacity int    `json:"capacity"`
+}
+
+type rollbackDTO struct {
+	Version int `json:"version"`
+}
+
+type maxInFlightDTO struct {
+	MaxInFlight *int `json:"max_in_flight"`
+}
+
 type TokenServicer interface {
-	SetCapacity(token string, capacity int) error
+	SetCapacity(actor, token string, capacity int) error
+	SetTenantCapacity(actor, tenant string, capacity int) error
+	SetTokenTenant(actor, token, tenant string) error
+	SetMaxInFlight(actor, token string, limit *int) error
+	ListSchedules(token string) ([]model.Schedule, error)
+	AddSchedule(actor string, sch model.Schedule) (int64, error)
+	DeleteSchedule(actor string, id int64) error
+	CreateKey(actor, hash string, k model.APIKey) (model.APIKey, error)
+	GetKey(prefix string) (model.APIKey, error)
+	RotateKey(actor, prefix, hash string, k model.APIKey, overlap time.Duration) (model.APIKey, error)
+	RevokeKey(actor, prefix string) error
+	ListCapacityHistory(token string) ([]model.CapacityVersion, error)
+	RollbackCapacity(actor, token string, version int) (int, error)
+	ImportCapacities(actor string, rows []model.TokenRow) (int, error)
+	ExportTokens(fn func(model.TokenRecord) error) error
+	GetToken(token string) (model.TokenRecord, error)
+	ListTokens(after string, limit int) ([]model.TokenRecord, error)
+	DeleteToken(actor, token string) error
+}
+
+// KeyHasher hashes raw API keys received by handlers, keys are stored and looked up by their hashes only
+type KeyHasher interface {
+	Hash(key string) string
 }
 
 type TokenHandler struct {
 	service TokenServicer
+	hasher  KeyHasher
 	l       *slog.Logger
 }
 
-func NewTokenHandler(service TokenServicer, l *slog.Logger) *TokenHandler {
-	return &TokenHandler{service: service, l: l}
+func NewTokenHandler(service TokenServicer, hasher KeyHasher, l *slog.Logger) *TokenHandler {
+	return &TokenHandler{service: service, hasher: hasher, l: l}
+}
+
+func (h *TokenHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("POST /{$}", h.SetCapacity)
+	mux.HandleFunc("POST /tenants", h.SetTenantCapacity)
+	mux.HandleFunc("GET /tokens/{token}/history", h.ListCapacityHistory)
+	mux.HandleFunc("POST /tokens/{token}/rollback", h.RollbackCapacity)
+	mux.HandleFunc("GET /tokens", h.ListTokens)
+	mux.HandleFunc("GET /tokens/{token}", h.GetToken)
+	mux.HandleFunc("DELETE /tokens/{token}", h.DeleteToken)
+	mux.HandleFunc("POST /tokens/import", h.ImportCapacities)
+	mux.HandleFunc("GET /tokens/export", h.ExportTokens)
+	mux.HandleFunc("PUT /tokens/{token}/tenant", h.SetTokenTenant)
+	mux.HandleFunc("PUT /tokens/{token}/max_in_flight", h.SetMaxInFlight)
+	mux.HandleFunc("GET /tokens/{token}/schedules", h.ListSchedules)
+	mux.HandleFunc("POST /tokens/{token}/schedules", h.AddSchedule)
+	mux.HandleFunc("DELETE /schedules/{id}", h.DeleteSchedule)
+	mux.HandleFunc("POST /keys", h.CreateKey)
+	mux.HandleFunc("GET /keys/{prefix}", h.GetKey)
+	mux.HandleFunc("POST /keys/{prefix}/rotate", h.RotateKey)
+	mux.HandleFunc("POST /keys/{prefix}/revoke", h.RevokeKey)
 }
 
 func (h *TokenHandler) SetCapacity(w http.ResponseWriter, r *http.Request) {
@@ -33,12 +95,12 @@ func (h *TokenHandler) SetCapacity(w http.ResponseWriter, r *http.Request) {
 
 	var d dto
 	if err := parse(r.Body, &d); err != nil {
-		w.Write([]byte("failed to parse request parameters"))
 		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
 		return
 	}
 
-	err := h.service.SetCapacity(d.Token, d.Capacity)
+	err := h.service.SetCapacity(auth.Actor(r.Context()), h.hasher.Hash(d.Token), d.Capacity)
 	if err != nil {
 		h.l.Error(fmt.Sprintf("Failed to set capacity: %v", err.Error()))
 		w.WriteHeader(http.StatusInternalServerError)
@@ -48,6 +110,108 @@ func (h *TokenHandler) SetCapacity(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+func (h *TokenHandler) ListCapacityHistory(w http.ResponseWriter, r *http.Request) {
+	history, err := h.service.ListCapacityHistory(h.hasher.Hash(r.PathValue("token")))
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to list capacity history: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if history == nil {
+		history = []model.CapacityVersion{}
+	}
+	writeJSON(w, h.l, http.StatusOK, history)
+}
+
+// RollbackCapacity sets capacity of token back to the one of version, rollback becomes the latest version
+func (h *TokenHandler) RollbackCapacity(w http.ResponseWriter, r *http.Request) {
+	var d rollbackDTO
+	if err := parse(r.Body, &d); err != nil || d.Version <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	token := h.hasher.Hash(r.PathValue("token"))
+	capacity, err := h.service.RollbackCapacity(auth.Actor(r.Context()), token, d.Version)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to roll capacity back: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusOK, dto{Token: r.PathValue("token"), Capacity: capacity})
+}
+
+func (h *TokenHandler) SetTenantCapacity(w http.ResponseWriter, r *http.Request) {
+	var d tenantDTO
+	if err := parse(r.Body, &d); err != nil || d.Tenant == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err := h.service.SetTenantCapacity(auth.Actor(r.Context()), d.Tenant, d.Capacity)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to set tenant capacity: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetTokenTenant attaches token to tenant, empty tenant detaches it
+func (h *TokenHandler) SetTokenTenant(w http.ResponseWriter, r *http.Request) {
+	var d tenantDTO
+	if err := parse(r.Body, &d); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err := h.service.SetTokenTenant(auth.Actor(r.Context()), h.hasher.Hash(r.PathValue("token")), d.Tenant)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to set token tenant: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// SetMaxInFlight sets concurrency limit of token, null resets it to default
+func (h *TokenHandler) SetMaxInFlight(w http.ResponseWriter, r *http.Request) {
+	var d maxInFlightDTO
+	if err := parse(r.Body, &d); err != nil || (d.MaxInFlight != nil && *d.MaxInFlight < 0) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err := h.service.SetMaxInFlight(auth.Actor(r.Context()), h.hasher.Hash(r.PathValue("token")), d.MaxInFlight)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to set max in flight: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
 func parse(r io.Reader, payload any) error {
 	if r == nil {
 		return fmt.Errorf("parsing from nil reader")
@@ -60,3 +224,12 @@ func parse(r io.Reader, payload any) error {
 
 	return nil
 }
+
+func writeJSON(w http.ResponseWriter, l *slog.Logger, code int, payload any) {
+	w.Header().Add("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(payload); err != nil {
+		l.Error(fmt.Sprintf("failed to write response: %v", err))
+	}
+}
@@ -0,0 +1,94 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type banDTO struct {
+	Token    string `json:"token"`
+	Duration string `json:"duration"`
+}
+
+type PenaltyServicer interface {
+	ListBans(since time.Time) ([]model.Ban, error)
+	SaveBan(b model.Ban) error
+	DeleteBan(token string) error
+}
+
+type PenaltyHandler struct {
+	service PenaltyServicer
+	hasher  KeyHasher
+	l       *slog.Logger
+}
+
+func NewPenaltyHandler(service PenaltyServicer, hasher KeyHasher, l *slog.Logger) *PenaltyHandler {
+	return &PenaltyHandler{service: service, hasher: hasher, l: l}
+}
+
+func (h *PenaltyHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /bans", h.ListBans)
+	mux.HandleFunc("POST /bans", h.Ban)
+	mux.HandleFunc("DELETE /bans/{token}", h.Unban)
+}
+
+// ListBans returns bans which are active now
+func (h *PenaltyHandler) ListBans(w http.ResponseWriter, r *http.Request) {
+	bans, err := h.service.ListBans(time.Now())
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to list bans: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if bans == nil {
+		bans = []model.Ban{}
+	}
+	writeJSON(w, h.l, http.StatusOK, bans)
+}
+
+// Ban bans token manually for the duration
+func (h *PenaltyHandler) Ban(w http.ResponseWriter, r *http.Request) {
+	var d banDTO
+	if err := parse(r.Body, &d); err != nil || d.Token == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	duration, err := time.ParseDuration(d.Duration)
+	if err != nil || duration <= 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse ban duration"))
+		return
+	}
+
+	ban := model.Ban{Token: h.hasher.Hash(d.Token), BannedUntil: time.Now().Add(duration)}
+	if err := h.service.SaveBan(ban); err != nil {
+		h.l.Error(fmt.Sprintf("Failed to ban token: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusOK, ban)
+}
+
+func (h *PenaltyHandler) Unban(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteBan(h.hasher.Hash(r.PathValue("token")))
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to unban token: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
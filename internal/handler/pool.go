@@ -0,0 +1,142 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Arzeeq/cloud-camp/internal/pool"
+	"gopkg.in/yaml.v2"
+)
+
+type backendDTO struct {
+	URL string `json:"url"`
+}
+
+type BackendPooler interface {
+	Backends() []pool.Backend
+	Add(server string) error
+	Remove(server string) error
+	Drain(server string) error
+	Undrain(server string) error
+}
+
+type HealthChecker interface {
+	CheckAll()
+}
+
+// PoolHandler serves admin API of load balancer, changes of backends are kept in memory only
+type PoolHandler struct {
+	pool   BackendPooler
+	hc     HealthChecker
+	config any
+	l      *slog.Logger
+}
+
+// NewPoolHandler creates handler, config is shown as yaml with fields hidden from yaml omitted
+func NewPoolHandler(pool BackendPooler, hc HealthChecker, config any, l *slog.Logger) *PoolHandler {
+	return &PoolHandler{pool: pool, hc: hc, config: config, l: l}
+}
+
+func (h *PoolHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /backends", h.ListBackends)
+	mux.HandleFunc("POST /backends", h.AddBackend)
+	mux.HandleFunc("DELETE /backends", h.RemoveBackend)
+	mux.HandleFunc("POST /backends/drain", h.DrainBackend)
+	mux.HandleFunc("POST /backends/undrain", h.UndrainBackend)
+	mux.HandleFunc("POST /healthcheck", h.CheckHealth)
+	mux.HandleFunc("GET /config", h.GetConfig)
+}
+
+func (h *PoolHandler) ListBackends(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, h.l, http.StatusOK, h.pool.Backends())
+}
+
+func (h *PoolHandler) AddBackend(w http.ResponseWriter, r *http.Request) {
+	var d backendDTO
+	if err := parse(r.Body, &d); err != nil || d.URL == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err := h.pool.Add(d.URL)
+	if errors.Is(err, model.ErrConflict) {
+		w.WriteHeader(http.StatusConflict)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	h.l.Info("backend was added", slog.String("URL", d.URL), slog.String("actor", auth.Actor(r.Context())))
+	w.WriteHeader(http.StatusCreated)
+}
+
+// RemoveBackend removes backend given by url parameter
+func (h *PoolHandler) RemoveBackend(w http.ResponseWriter, r *http.Request) {
+	server := r.URL.Query().Get("url")
+	h.change(w, r, "removed", server, h.pool.Remove(server))
+}
+
+func (h *PoolHandler) DrainBackend(w http.ResponseWriter, r *http.Request) {
+	var d backendDTO
+	if err := parse(r.Body, &d); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	h.change(w, r, "drained", d.URL, h.pool.Drain(d.URL))
+}
+
+func (h *PoolHandler) UndrainBackend(w http.ResponseWriter, r *http.Request) {
+	var d backendDTO
+	if err := parse(r.Body, &d); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	h.change(w, r, "undrained", d.URL, h.pool.Undrain(d.URL))
+}
+
+// change responds with result of backend change and logs who made it
+func (h *PoolHandler) change(w http.ResponseWriter, r *http.Request, action, server string, err error) {
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to change backend: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	h.l.Info("backend was "+action, slog.String("URL", server), slog.String("actor", auth.Actor(r.Context())))
+	w.WriteHeader(http.StatusOK)
+}
+
+// CheckHealth checks all backends immediately and returns their state
+func (h *PoolHandler) CheckHealth(w http.ResponseWriter, r *http.Request) {
+	h.hc.CheckAll()
+	writeJSON(w, h.l, http.StatusOK, h.pool.Backends())
+}
+
+func (h *PoolHandler) GetConfig(w http.ResponseWriter, r *http.Request) {
+	data, err := yaml.Marshal(h.config)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to marshal config: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/yaml")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type quotaDTO struct {
+	model.Quota
+	DailyUsed   int64 `json:"daily_used"`
+	MonthlyUsed int64 `json:"monthly_used"`
+}
+
+type QuotaServicer interface {
+	GetQuota(token string) (model.Quota, error)
+	SetQuota(actor, token string, q model.Quota) error
+	GetUsage(token string, day, month time.Time) (int64, int64, error)
+}
+
+type QuotaHandler struct {
+	service  QuotaServicer
+	hasher   KeyHasher
+	location *time.Location
+	l        *slog.Logger
+}
+
+// NewQuotaHandler creates handler, periods of usage start in location
+func NewQuotaHandler(service QuotaServicer, hasher KeyHasher, location *time.Location, l *slog.Logger) *QuotaHandler {
+	return &QuotaHandler{service: service, hasher: hasher, location: location, l: l}
+}
+
+func (h *QuotaHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /tokens/{token}/quota", h.GetQuota)
+	mux.HandleFunc("PUT /tokens/{token}/quota", h.SetQuota)
+}
+
+// GetQuota returns own limits of token with its stored usage in the current day and month
+func (h *QuotaHandler) GetQuota(w http.ResponseWriter, r *http.Request) {
+	token := h.hasher.Hash(r.PathValue("token"))
+
+	q, err := h.service.GetQuota(token)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to get quota: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now().In(h.location)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, h.location)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, h.location)
+
+	daily, monthly, err := h.service.GetUsage(token, day, month)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to get quota usage: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusOK, quotaDTO{Quota: q, DailyUsed: daily, MonthlyUsed: monthly})
+}
+
+// SetQuota sets own limits of token, null resets limit to default and zero disables it
+func (h *QuotaHandler) SetQuota(w http.ResponseWriter, r *http.Request) {
+	var q model.Quota
+	if err := parse(r.Body, &q); err != nil || (q.Daily != nil && *q.Daily < 0) || (q.Monthly != nil && *q.Monthly < 0) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err := h.service.SetQuota(auth.Actor(r.Context()), h.hasher.Hash(r.PathValue("token")), q)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to set quota: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
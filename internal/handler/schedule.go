@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+func (h *TokenHandler) ListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := h.service.ListSchedules(h.hasher.Hash(r.PathValue("token")))
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to list schedules: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if schedules == nil {
+		schedules = []model.Schedule{}
+	}
+	writeJSON(w, h.l, http.StatusOK, schedules)
+}
+
+// AddSchedule adds capacity override of token, missing start and end mean the whole day
+func (h *TokenHandler) AddSchedule(w http.ResponseWriter, r *http.Request) {
+	var sch model.Schedule
+	if err := parse(r.Body, &sch); err != nil || sch.Capacity < 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+	sch.Token = h.hasher.Hash(r.PathValue("token"))
+
+	if sch.Start == "" {
+		sch.Start = "00:00"
+	}
+	if sch.End == "" {
+		sch.End = "24:00"
+	}
+	if err := validateSchedule(sch); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte(err.Error()))
+		return
+	}
+
+	id, err := h.service.AddSchedule(auth.Actor(r.Context()), sch)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to add schedule: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	sch.ID = id
+	writeJSON(w, h.l, http.StatusOK, sch)
+}
+
+func (h *TokenHandler) DeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	err = h.service.DeleteSchedule(auth.Actor(r.Context()), id)
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to delete schedule: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func validateSchedule(sch model.Schedule) error {
+	if _, err := model.ParseClock(sch.Start); err != nil {
+		return err
+	}
+	if _, err := model.ParseClock(sch.End); err != nil {
+		return err
+	}
+
+	for _, d := range sch.Weekdays {
+		if d < time.Sunday || d > time.Saturday {
+			return fmt.Errorf("weekday %d is out of range", d)
+		}
+	}
+
+	if sch.ValidFrom != nil && sch.ValidUntil != nil && !sch.ValidFrom.Before(*sch.ValidUntil) {
+		return errors.New("valid_from must be before valid_until")
+	}
+
+	return nil
+}
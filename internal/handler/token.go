@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+const maxListLimit = 1000
+
+// ListTokens returns page of tokens ordered by hash, the next page starts after hash of the last token
+func (h *TokenHandler) ListTokens(w http.ResponseWriter, r *http.Request) {
+	limit := 100
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxListLimit {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("failed to parse request parameters"))
+			return
+		}
+		limit = n
+	}
+
+	tokens, err := h.service.ListTokens(r.URL.Query().Get("after"), limit)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to list tokens: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if tokens == nil {
+		tokens = []model.TokenRecord{}
+	}
+	writeJSON(w, h.l, http.StatusOK, tokens)
+}
+
+func (h *TokenHandler) GetToken(w http.ResponseWriter, r *http.Request) {
+	t, err := h.service.GetToken(h.hasher.Hash(r.PathValue("token")))
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to get token: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, h.l, http.StatusOK, t)
+}
+
+func (h *TokenHandler) DeleteToken(w http.ResponseWriter, r *http.Request) {
+	err := h.service.DeleteToken(auth.Actor(r.Context()), h.hasher.Hash(r.PathValue("token")))
+	if errors.Is(err, model.ErrNotFound) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to delete token: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+var granularities = map[string]bool{
+	"minute": true,
+	"hour":   true,
+	"day":    true,
+	"month":  true,
+}
+
+type UsageServicer interface {
+	GetUsage(token string, from, to time.Time, granularity string) ([]model.Usage, error)
+}
+
+type UsageHandler struct {
+	service UsageServicer
+	hasher  KeyHasher
+	l       *slog.Logger
+}
+
+func NewUsageHandler(service UsageServicer, hasher KeyHasher, l *slog.Logger) *UsageHandler {
+	return &UsageHandler{service: service, hasher: hasher, l: l}
+}
+
+func (h *UsageHandler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /tokens/{token}/usage", h.GetUsage)
+}
+
+// GetUsage returns usage of token within [from, to) in RFC 3339,
+// by default the last day is returned with hour granularity
+func (h *UsageHandler) GetUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	to := time.Now()
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("failed to parse 'to' parameter"))
+			return
+		}
+		to = t
+	}
+
+	from := to.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte("failed to parse 'from' parameter"))
+			return
+		}
+		from = t
+	}
+
+	granularity := q.Get("granularity")
+	if granularity == "" {
+		granularity = "hour"
+	}
+	if !granularities[granularity] || !from.Before(to) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("failed to parse request parameters"))
+		return
+	}
+
+	usage, err := h.service.GetUsage(h.hasher.Hash(r.PathValue("token")), from, to, granularity)
+	if err != nil {
+		h.l.Error(fmt.Sprintf("Failed to get usage: %v", err.Error()))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	if usage == nil {
+		usage = []model.Usage{}
+	}
+	writeJSON(w, h.l, http.StatusOK, usage)
+}
@@ -55,6 +55,11 @@ func (hc *HealthCheck) start() {
 	}
 }
 
+// CheckAll checks all servers at once without waiting for the next interval
+func (hc *HealthCheck) CheckAll() {
+	hc.checkAll()
+}
+
 func (hc *HealthCheck) checkAll() {
 	var wg sync.WaitGroup
 
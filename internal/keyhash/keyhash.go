@@ -0,0 +1,51 @@
+package keyhash
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+// Hasher turns API keys into keyed hashes, so keys leaked from storage or memory can not be used
+type Hasher struct {
+	secret []byte
+}
+
+func New(secret []byte) *Hasher {
+	return &Hasher{secret: secret}
+}
+
+// FromEnv creates hasher with secret from the variable, random secret is used when it is empty and random is allowed.
+// Random secret suits only state which is not stored anywhere
+func FromEnv(name string, random bool) (*Hasher, error) {
+	secret := []byte(os.Getenv(name))
+	if len(secret) > 0 {
+		return New(secret), nil
+	}
+	if !random {
+		return nil, fmt.Errorf("key hash secret variable '%s' is empty", name)
+	}
+
+	secret = make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, fmt.Errorf("failed to generate key hash secret: %w", err)
+	}
+
+	return New(secret), nil
+}
+
+// Hash returns hex encoded HMAC-SHA256 of the key
+func (h *Hasher) Hash(key string) string {
+	mac := hmac.New(sha256.New, h.secret)
+	mac.Write([]byte(key))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Fingerprint identifies secret without revealing it
+func (h *Hasher) Fingerprint() string {
+	return h.Hash("key hash fingerprint")
+}
@@ -0,0 +1,236 @@
+package limiter
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/access"
+	"github.com/Arzeeq/cloud-camp/internal/apikey"
+	"github.com/Arzeeq/cloud-camp/internal/auth"
+	"github.com/Arzeeq/cloud-camp/internal/bucket"
+	"github.com/Arzeeq/cloud-camp/internal/config"
+	"github.com/Arzeeq/cloud-camp/internal/handler"
+	"github.com/Arzeeq/cloud-camp/internal/keyhash"
+	"github.com/Arzeeq/cloud-camp/internal/penalty"
+	"github.com/Arzeeq/cloud-camp/internal/quota"
+	"github.com/Arzeeq/cloud-camp/internal/ratelimiter"
+	"github.com/Arzeeq/cloud-camp/internal/service"
+	"github.com/Arzeeq/cloud-camp/internal/storage/pg"
+	"github.com/Arzeeq/cloud-camp/internal/usage"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Services are backed by Postgres, rate limiter built without them keeps its state in memory only
+type Services struct {
+	Hasher  *keyhash.Hasher
+	Admin   *service.AdminService
+	Token   *service.TokenService
+	Access  *service.AccessService
+	Penalty *service.PenaltyService
+	Quota   *service.QuotaService
+	Usage   *service.UsageService
+}
+
+// NewServices creates services, hasher must be the one stored keys were hashed with
+func NewServices(db *pgxpool.Pool, hasher *keyhash.Hasher, location *time.Location) *Services {
+	return &Services{
+		Hasher:  hasher,
+		Admin:   service.NewAdminService(pg.NewAdminStorage(db)),
+		Token:   service.NewTokenService(pg.NewTokenStorage(db), location),
+		Access:  service.NewAccessService(pg.NewAccessStorage(db)),
+		Penalty: service.NewPenaltyService(pg.NewPenaltyStorage(db)),
+		Quota:   service.NewQuotaService(pg.NewQuotaStorage(db)),
+		Usage:   service.NewUsageService(pg.NewUsageStorage(db), location),
+	}
+}
+
+// Register mounts admin API of services
+func (s *Services) Register(mux *http.ServeMux, location *time.Location, l *slog.Logger) {
+	handler.NewAdminHandler(s.Admin, s.Hasher, l).Register(mux)
+	handler.NewTokenHandler(s.Token, s.Hasher, l).Register(mux)
+	handler.NewAccessHandler(s.Access, s.Hasher, l).Register(mux)
+	handler.NewPenaltyHandler(s.Penalty, s.Hasher, l).Register(mux)
+	handler.NewQuotaHandler(s.Quota, s.Hasher, location, l).Register(mux)
+	handler.NewUsageHandler(s.Usage, s.Hasher, l).Register(mux)
+	mux.Handle("GET /debug/vars", expvar.Handler())
+}
+
+// Serve starts admin API on port in background, every request is authenticated
+func (s *Services) Serve(port int, cfg config.Admin, location *time.Location, l *slog.Logger) error {
+	mux := http.NewServeMux()
+	s.Register(mux, location, l)
+
+	return auth.Serve(port, cfg, s.Admin, mux, l)
+}
+
+// OpenDB connects to database, migrates it up and hashes keys stored before keys were hashed
+func OpenDB(migDir, connStr string, hasher *keyhash.Hasher, l *slog.Logger) (*pgxpool.Pool, error) {
+	// initialize connections pool
+	db, err := pgxpool.New(context.Background(), connStr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to initialize connections pool: %v", err.Error())
+	}
+
+	// migrate up
+	migrator := pg.NewMigrator(migDir, connStr)
+	if err := migrator.Up(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate up: %v", err.Error())
+	}
+
+	hashed, err := pg.HashKeys(context.Background(), db, hasher)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to hash stored keys: %w", err)
+	}
+	if hashed > 0 {
+		l.Info("stored keys were hashed", slog.Int("count", hashed))
+	}
+
+	return db, nil
+}
+
+type stopper interface {
+	Stop()
+}
+
+// New builds rate limiter from config, services may be nil to keep limits, bans and quotas in memory.
+// Keys are hashed with hasher before they reach any limit. Returned function stops background routines and flushes pending usage
+func New(cfg *config.Limiter, services *Services, hasher *keyhash.Hasher, l *slog.Logger) (*ratelimiter.RateLimiter, func(), error) {
+	var stoppers []stopper
+	stop := func() {
+		for i := len(stoppers) - 1; i >= 0; i-- {
+			stoppers[i].Stop()
+		}
+	}
+
+	policies, err := newPolicies(cfg, services, &stoppers)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	l.Info("rate limit policies were built", slog.Int("count", len(policies)))
+
+	// load allow and deny lists
+	trusted, err := ratelimiter.ParseCIDRs(cfg.Access.TrustedProxies)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+
+	var accessService access.Servicer
+	if services != nil {
+		accessService = services.Access
+	}
+	lists, err := access.New(cfg.Access.Allow, cfg.Access.Deny, cfg.Access.RefreshInterval, hasher, accessService, l)
+	if err != nil {
+		stop()
+		return nil, nil, err
+	}
+	stoppers = append(stoppers, lists)
+
+	opts := []ratelimiter.Option{ratelimiter.WithAccessLists(lists, trusted), ratelimiter.WithKeyHasher(hasher)}
+	if cfg.Penalty.Threshold > 0 {
+		var penaltyService penalty.Servicer
+		if services != nil {
+			penaltyService = services.Penalty
+		}
+		box := penalty.New(cfg.Penalty, penaltyService, l)
+		stoppers = append(stoppers, box)
+		opts = append(opts, ratelimiter.WithPenaltyBox(box))
+	}
+
+	// tokens may have own quotas even when default ones are disabled
+	var quotaService quota.Servicer
+	if services != nil {
+		quotaService = services.Quota
+	}
+	counter := quota.New(cfg.Quota.DefaultDaily, cfg.Quota.DefaultMonthly, cfg.Location, cfg.Quota.FlushInterval, quotaService, l)
+	stoppers = append(stoppers, counter)
+	opts = append(opts, ratelimiter.WithQuota(counter))
+
+	// keys are issued and usage report is served by storage only
+	if services != nil {
+		validator := apikey.NewValidator(cfg.KeyCacheTTL, cfg.RequireIssued, services.Token, l)
+		stoppers = append(stoppers, validator)
+		opts = append(opts, ratelimiter.WithKeyValidator(validator))
+
+		recorder := usage.New(cfg.Usage.FlushInterval, services.Usage, l)
+		stoppers = append(stoppers, recorder)
+		opts = append(opts, ratelimiter.WithUsage(recorder))
+	}
+
+	return ratelimiter.New(policies, l, opts...), stop, nil
+}
+
+// newPolicies builds policy per configured rule followed by the default one backed by token service
+func newPolicies(cfg *config.Limiter, services *Services, stoppers *[]stopper) ([]*ratelimiter.Policy, error) {
+	extractor, err := ratelimiter.NewExtractor(cfg.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to build key extractor: %w", err)
+	}
+
+	// global ceiling is shared by all policies, so requests matched by rules count against it too
+	var global []*bucket.Global
+	if cfg.GlobalCapacity > 0 {
+		g := bucket.NewGlobal(cfg.GlobalCapacity, cfg.Interval)
+		*stoppers = append(*stoppers, g)
+		global = append(global, g)
+	}
+
+	policies := make([]*ratelimiter.Policy, 0, len(cfg.Rules)+1)
+	for _, rule := range cfg.Rules {
+		globals := global
+		if rule.GlobalCapacity > 0 {
+			g := bucket.NewGlobal(rule.GlobalCapacity, rule.Interval)
+			*stoppers = append(*stoppers, g)
+			globals = append([]*bucket.Global{g}, global...)
+		}
+
+		b := bucket.New(rule.Capacity, globals, rule.Interval, nil)
+		*stoppers = append(*stoppers, b)
+
+		p, err := ratelimiter.NewPolicy(rule, b, extractor)
+		if err != nil {
+			return nil, err
+		}
+
+		if rule.MaxInFlight > 0 {
+			f := bucket.NewInFlight(rule.MaxInFlight, rule.Interval, nil)
+			*stoppers = append(*stoppers, f)
+			p.InFlight = f
+		}
+
+		policies = append(policies, p)
+	}
+
+	var tokenService bucket.TokenServicer
+	var inFlightService bucket.InFlightServicer
+	if services != nil {
+		tokenService = services.Token
+		inFlightService = services.Token
+	}
+
+	b := bucket.New(cfg.DefaultCapacity, global, cfg.Interval, tokenService)
+	*stoppers = append(*stoppers, b)
+
+	p, err := ratelimiter.NewPolicy(config.Rule{Name: "default", Mode: cfg.Mode, Cost: cfg.Cost, Queue: cfg.Queue}, b, extractor)
+	if err != nil {
+		return nil, err
+	}
+
+	// own concurrency limits of tokens are looked up only when concurrency limit is enabled
+	if cfg.MaxInFlight > 0 {
+		f := bucket.NewInFlight(cfg.MaxInFlight, cfg.Interval, inFlightService)
+		*stoppers = append(*stoppers, f)
+		p.InFlight = f
+	}
+
+	policies = append(policies, p)
+
+	return policies, nil
+}
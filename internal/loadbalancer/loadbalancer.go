@@ -1,47 +1,206 @@
 package loadbalancer
 
 import (
+	"context"
 	"errors"
 	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/breaker"
+	"github.com/Arzeeq/cloud-camp/internal/config"
 )
 
 type Pooler interface {
-	Get() (string, error)
+	// Pick returns server for the next request skipping servers rejected by allow,
+	// done must be called when the request is finished
+	Pick(allow func(server string) bool) (string, func(), error)
+	// SetCircuit sets state of circuit breaker of server, server with open circuit gets no requests
+	SetCircuit(server, state string)
+}
+
+type resultKey struct{}
+
+// result of request to server, seen is false when neither response nor error was received
+type result struct {
+	start    time.Time
+	latency  time.Duration
+	seen     bool
+	failed   bool
+	canceled bool
+}
+
+// upstream proxies requests to one server with its own transport, so requests and connections
+// of removed server can be closed
+type upstream struct {
+	rp     *httputil.ReverseProxy
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
 type LoadBalancer struct {
-	pool Pooler
-	l    *slog.Logger
+	pool     Pooler
+	cb       config.CircuitBreaker
+	proxies  map[string]*upstream
+	breakers map[string]*breaker.Breaker
+	mu       sync.Mutex
+	l        *slog.Logger
 }
 
-func New(pool Pooler, logger *slog.Logger) (*LoadBalancer, error) {
+// New creates load balancer, every server gets its own circuit breaker when cb is enabled
+func New(pool Pooler, cb config.CircuitBreaker, logger *slog.Logger) (*LoadBalancer, error) {
 	if pool == nil || logger == nil {
 		return nil, errors.New("nil values in Load Balancer constructor")
 	}
 
 	return &LoadBalancer{
-		pool: pool,
-		l:    logger,
+		pool:     pool,
+		cb:       cb,
+		proxies:  make(map[string]*upstream),
+		breakers: make(map[string]*breaker.Breaker),
+		l:        logger,
 	}, nil
 }
 
 func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	server, err := lb.pool.Get()
+	var br *breaker.Breaker
+	server, done, err := lb.pool.Pick(func(server string) bool {
+		// half-open circuit may have no probes left
+		br = lb.breaker(server)
+		return br == nil || br.Allow()
+	})
 	if err != nil {
-		lb.l.Error(err.Error())
-		w.WriteHeader(http.StatusInternalServerError)
+		lb.l.Warn(err.Error())
+		w.WriteHeader(http.StatusServiceUnavailable)
 		return
 	}
 
-	serverURL, err := url.Parse(server)
+	if br != nil {
+		// state of new breaker is not reported yet
+		br.Notify()
+	}
+
+	lb.serve(w, r, server, br)
+	done()
+}
+
+func (lb *LoadBalancer) serve(w http.ResponseWriter, r *http.Request, server string, br *breaker.Breaker) {
+	u, err := lb.proxy(server)
 	if err != nil {
 		lb.l.Error("failed to parse host's url received from pool", slog.String("error", err.Error()))
 		w.WriteHeader(http.StatusInternalServerError)
+		if br != nil {
+			br.Release()
+		}
 		return
 	}
 
-	httputil.NewSingleHostReverseProxy(serverURL).ServeHTTP(w, r)
+	// request is canceled when server is removed before it finishes
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	stop := context.AfterFunc(u.ctx, cancel)
+	defer stop()
+
+	if br == nil {
+		u.rp.ServeHTTP(w, r.WithContext(ctx))
+		return
+	}
+
+	res := &result{start: time.Now()}
+	u.rp.ServeHTTP(w, r.WithContext(context.WithValue(ctx, resultKey{}, res)))
+
+	if !res.seen || res.canceled {
+		br.Release()
+		return
+	}
+	br.Record(res.failed, res.latency)
+}
+
+func (lb *LoadBalancer) proxy(server string) (*upstream, error) {
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if u, ok := lb.proxies[server]; ok {
+		return u, nil
+	}
+
+	serverURL, err := url.Parse(server)
+	if err != nil {
+		return nil, err
+	}
+
+	rp := httputil.NewSingleHostReverseProxy(serverURL)
+	rp.Transport = http.DefaultTransport.(*http.Transport).Clone()
+	rp.ModifyResponse = func(resp *http.Response) error {
+		if res, ok := resp.Request.Context().Value(resultKey{}).(*result); ok {
+			res.seen = true
+			res.latency = time.Since(res.start)
+			res.failed = resp.StatusCode >= http.StatusInternalServerError
+		}
+		return nil
+	}
+	rp.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		if res, ok := r.Context().Value(resultKey{}).(*result); ok {
+			res.seen = true
+			res.latency = time.Since(res.start)
+			res.canceled = errors.Is(r.Context().Err(), context.Canceled)
+			res.failed = !res.canceled
+		}
+
+		lb.l.Error("upstream request failed", slog.String("URL", server), slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusBadGateway)
+	}
+	u := &upstream{rp: rp}
+	u.ctx, u.cancel = context.WithCancel(context.Background())
+	lb.proxies[server] = u
+
+	return u, nil
+}
+
+// breaker returns circuit breaker of server, nil is returned when circuit breakers are disabled
+func (lb *LoadBalancer) breaker(server string) *breaker.Breaker {
+	if !lb.cb.Enabled {
+		return nil
+	}
+
+	lb.mu.Lock()
+	defer lb.mu.Unlock()
+
+	if br, ok := lb.breakers[server]; ok {
+		return br
+	}
+
+	// breaker is created while pool is locked, so its closed state is reported by Notify later
+	br := breaker.New(lb.cb, func(state breaker.State) {
+		lb.pool.SetCircuit(server, string(state))
+		lb.l.Warn("Circuit breaker changed state", slog.String("URL", server), slog.String("state", string(state)))
+	})
+	lb.breakers[server] = br
+
+	return br
+}
+
+// Forget closes idle connections to server removed from pool, its requests in flight are canceled only
+// when its drain has expired and are left to finish otherwise
+func (lb *LoadBalancer) Forget(server string, expired bool) {
+	lb.mu.Lock()
+	u, ok := lb.proxies[server]
+	delete(lb.proxies, server)
+	br := lb.breakers[server]
+	delete(lb.breakers, server)
+	lb.mu.Unlock()
+
+	if ok {
+		if expired {
+			u.cancel()
+		}
+		u.rp.Transport.(*http.Transport).CloseIdleConnections()
+	}
+	if br != nil {
+		br.Stop()
+	}
+	lb.l.Info("Server was removed", slog.String("URL", server))
 }
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+const (
+	ListAllow = "allow"
+	ListDeny  = "deny"
+)
+
+// AccessEntry is API key or IP CIDR in allow or deny list, entry without expiry never expires
+type AccessEntry struct {
+	ID        int64      `json:"id"`
+	List      string     `json:"list"`
+	Entry     string     `json:"entry"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrKeyExpired = errors.New("key has expired")
+	ErrKeyRevoked = errors.New("key has been revoked")
+	// ErrKeyUnknown is returned for keys which were not issued when issued keys are required
+	ErrKeyUnknown = errors.New("key was not issued")
+	// ErrKeyUnverified is returned when state of key can not be loaded and is not cached
+	ErrKeyUnverified = errors.New("key can not be verified")
+)
+
+// APIKey is a key issued by token service, it is identified by its visible prefix since the key itself is stored hashed.
+// Key is set only in response to issuance and rotation
+type APIKey struct {
+	Prefix    string     `json:"prefix"`
+	Key       string     `json:"key,omitempty"`
+	Capacity  int        `json:"capacity"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Check returns why key can not be used at t, revocation wins over expiry
+func (k APIKey) Check(t time.Time) error {
+	if k.RevokedAt != nil && !t.Before(*k.RevokedAt) {
+		return ErrKeyRevoked
+	}
+	if k.ExpiresAt != nil && !t.Before(*k.ExpiresAt) {
+		return ErrKeyExpired
+	}
+
+	return nil
+}
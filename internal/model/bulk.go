@@ -0,0 +1,41 @@
+package model
+
+import "time"
+
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// TokenRow is a row of bulk import. Raw token is hashed on import, token hash taken from export is imported as it is
+type TokenRow struct {
+	Token     string `json:"token,omitempty"`
+	TokenHash string `json:"token_hash,omitempty"`
+	Capacity  int    `json:"capacity"`
+}
+
+// RowError is a reason row was rejected, rows are numbered from 1 without CSV header
+type RowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+// ImportReport describes bulk import, nothing is imported when there are errors or it is a dry run
+type ImportReport struct {
+	Rows     int        `json:"rows"`
+	Imported int        `json:"imported"`
+	DryRun   bool       `json:"dry_run"`
+	Errors   []RowError `json:"errors"`
+}
+
+// TokenRecord is a row of token_buckets export, tokens are exported as their hashes
+type TokenRecord struct {
+	TokenHash   string     `json:"token_hash"`
+	KeyPrefix   string     `json:"key_prefix,omitempty"`
+	Capacity    int        `json:"capacity"`
+	Tenant      *string    `json:"tenant"`
+	MaxInFlight *int       `json:"max_in_flight"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+}
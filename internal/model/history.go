@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+// CapacityVersion is a change of token capacity, old capacity is nil when token was created by the change
+type CapacityVersion struct {
+	Version     int       `json:"version"`
+	OldCapacity *int      `json:"old_capacity"`
+	NewCapacity int       `json:"new_capacity"`
+	Actor       string    `json:"actor"`
+	ChangedAt   time.Time `json:"changed_at"`
+}
@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+// Ban rejects requests of token until BannedUntil, Strikes is how many times token was banned in a row
+type Ban struct {
+	Token       string    `json:"token"`
+	Strikes     int       `json:"strikes"`
+	BannedUntil time.Time `json:"banned_until"`
+}
@@ -0,0 +1,22 @@
+package model
+
+import "time"
+
+const (
+	PeriodDay   = "day"
+	PeriodMonth = "month"
+)
+
+// Quota limits token usage per day and month, nil means default limit and zero means no limit
+type Quota struct {
+	Daily   *int64 `json:"daily"`
+	Monthly *int64 `json:"monthly"`
+}
+
+// QuotaUsage is how many tokens were used within period starting at PeriodStart
+type QuotaUsage struct {
+	Token       string    `json:"token"`
+	Period      string    `json:"period"`
+	PeriodStart time.Time `json:"period_start"`
+	Used        int64     `json:"used"`
+}
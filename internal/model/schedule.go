@@ -0,0 +1,79 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Schedule overrides token capacity on Weekdays between Start and End ("15:04", End may be "24:00")
+// within optional validity window. Start after End means the range wraps over midnight
+type Schedule struct {
+	ID         int64          `json:"id"`
+	Token      string         `json:"token"`
+	Capacity   int            `json:"capacity"`
+	Weekdays   []time.Weekday `json:"weekdays"`
+	Start      string         `json:"start"`
+	End        string         `json:"end"`
+	ValidFrom  *time.Time     `json:"valid_from,omitempty"`
+	ValidUntil *time.Time     `json:"valid_until,omitempty"`
+	Priority   int            `json:"priority"`
+}
+
+// TokenLimits are stored limits of token, schedules are ordered from the most prioritized one
+type TokenLimits struct {
+	Capacity       int
+	Tenant         string
+	TenantCapacity int
+	Schedules      []Schedule
+}
+
+// Active reports whether schedule applies at t, t must be in the configured location
+func (s Schedule) Active(t time.Time) bool {
+	if s.ValidFrom != nil && t.Before(*s.ValidFrom) {
+		return false
+	}
+	if s.ValidUntil != nil && !t.Before(*s.ValidUntil) {
+		return false
+	}
+
+	if len(s.Weekdays) > 0 {
+		found := false
+		for _, d := range s.Weekdays {
+			if d == t.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	start, err := ParseClock(s.Start)
+	if err != nil {
+		return false
+	}
+	end, err := ParseClock(s.End)
+	if err != nil {
+		return false
+	}
+
+	minute := t.Hour()*60 + t.Minute()
+	if start <= end {
+		return minute >= start && minute < end
+	}
+	return minute >= start || minute < end
+}
+
+// ParseClock returns minutes since midnight of "15:04" formatted clock, "24:00" is allowed
+func ParseClock(clock string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(clock, "%d:%d", &h, &m); err != nil {
+		return 0, fmt.Errorf("failed to parse clock '%s': %w", clock, err)
+	}
+	if h < 0 || m < 0 || m > 59 || h*60+m > 24*60 {
+		return 0, fmt.Errorf("clock '%s' is out of range", clock)
+	}
+
+	return h*60 + m, nil
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Usage counts requests of token within time bucket starting at Start
+type Usage struct {
+	Token    string    `json:"token"`
+	Start    time.Time `json:"start"`
+	Allowed  int64     `json:"allowed"`
+	Rejected int64     `json:"rejected"`
+}
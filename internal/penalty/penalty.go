@@ -0,0 +1,176 @@
+package penalty
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/config"
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type Servicer interface {
+	ListBans(since time.Time) ([]model.Ban, error)
+	SaveBan(b model.Ban) error
+}
+
+// Box bans keys which get more than threshold rejections within window.
+// Every next ban in a row lasts twice as long as the previous one up to max ban,
+// the row is reset when key behaves for reset after period since its last ban
+type Box struct {
+	cfg     config.Penalty
+	hits    map[string][]time.Time
+	bans    map[string]model.Ban
+	pending map[string]bool
+	mu      sync.Mutex
+	ticker  *time.Ticker
+	done    chan struct{}
+	service Servicer
+	l       *slog.Logger
+}
+
+// New creates penalty box, service may be nil when bans should not survive restarts
+func New(cfg config.Penalty, service Servicer, l *slog.Logger) *Box {
+	b := &Box{
+		cfg:     cfg,
+		hits:    make(map[string][]time.Time),
+		bans:    make(map[string]model.Ban),
+		pending: make(map[string]bool),
+		done:    make(chan struct{}),
+		service: service,
+		l:       l,
+	}
+
+	b.ticker = time.NewTicker(cfg.RefreshInterval)
+	if service != nil {
+		b.reload()
+	}
+	go b.refresh()
+
+	return b
+}
+
+func (b *Box) refresh() {
+	for {
+		select {
+		case <-b.ticker.C:
+			if b.service != nil {
+				b.reload()
+			}
+			b.cleanup()
+		case <-b.done:
+			return
+		}
+	}
+}
+
+// reload replaces bans with stored ones except for bans which are not saved yet
+func (b *Box) reload() {
+	bans, err := b.service.ListBans(time.Now().Add(-b.cfg.ResetAfter))
+	if err != nil {
+		b.l.Error(fmt.Sprintf("failed to reload bans: %v", err))
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	loaded := make(map[string]model.Ban, len(bans))
+	for _, ban := range bans {
+		loaded[ban.Token] = ban
+	}
+	for token := range b.pending {
+		loaded[token] = b.bans[token]
+	}
+	b.bans = loaded
+}
+
+func (b *Box) cleanup() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	for token, hits := range b.hits {
+		if len(hits) == 0 || now.Sub(hits[len(hits)-1]) > b.cfg.Window {
+			delete(b.hits, token)
+		}
+	}
+	for token, ban := range b.bans {
+		if !b.pending[token] && now.Sub(ban.BannedUntil) > b.cfg.ResetAfter {
+			delete(b.bans, token)
+		}
+	}
+}
+
+// Banned returns end of the ban if key is banned now
+func (b *Box) Banned(key string) (time.Time, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ban, ok := b.bans[key]
+	if !ok || !time.Now().Before(ban.BannedUntil) {
+		return time.Time{}, false
+	}
+
+	return ban.BannedUntil, true
+}
+
+// Strike records rejection of key and bans it when threshold is exceeded
+func (b *Box) Strike(key string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	hits := b.hits[key]
+	for len(hits) > 0 && now.Sub(hits[0]) > b.cfg.Window {
+		hits = hits[1:]
+	}
+	hits = append(hits, now)
+
+	if len(hits) <= b.cfg.Threshold {
+		b.hits[key] = hits
+		return
+	}
+	delete(b.hits, key)
+
+	strikes := 1
+	if prev, ok := b.bans[key]; ok && now.Sub(prev.BannedUntil) <= b.cfg.ResetAfter {
+		strikes = prev.Strikes + 1
+	}
+
+	duration := b.cfg.Ban
+	for i := 1; i < strikes && duration < b.cfg.MaxBan; i++ {
+		duration *= 2
+	}
+	duration = min(duration, b.cfg.MaxBan)
+
+	ban := model.Ban{Token: key, Strikes: strikes, BannedUntil: now.Add(duration)}
+	b.bans[key] = ban
+	b.l.Warn("key was banned", slog.String("key", key), slog.Int("strikes", strikes), slog.Duration("duration", duration))
+
+	if b.service != nil {
+		b.pending[key] = true
+		go b.save(ban)
+	}
+}
+
+func (b *Box) save(ban model.Ban) {
+	err := b.service.SaveBan(ban)
+	if err != nil {
+		b.l.Error(fmt.Sprintf("failed to save ban: %v", err))
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	// newer ban may have been issued while this one was saved
+	if b.bans[ban.Token].BannedUntil.Equal(ban.BannedUntil) {
+		delete(b.pending, ban.Token)
+	}
+}
+
+func (b *Box) Stop() {
+	b.ticker.Stop()
+	close(b.done)
+}
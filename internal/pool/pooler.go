@@ -1,11 +1,70 @@
 package pool
 
+import "time"
+
 type Pooler interface {
-	Get() (string, error)
+	// Get returns server for the next request, done must be called when the request is finished
+	Get() (string, func(), error)
+	// Pick works as Get but skips servers rejected by allow
+	Pick(allow func(server string) bool) (string, func(), error)
 	// GetAll return URLs of all alive and dead servers
 	GetAll() []string
 	// Enable returns true if server were marked as dead before
 	Enable(string) bool
 	// Disable returns true if server were marked as alive before
 	Disable(string) bool
+	// Backends returns state of all servers in pool order
+	Backends() []Backend
+	// Add adds server which is considered alive until health check
+	Add(string) error
+	Remove(string) error
+	// Drain stops sending new requests to server, it is removed when its requests finish or drain timeout passes.
+	// Health checks do not change state of draining server
+	Drain(string) error
+	// Undrain returns draining server to rotation
+	Undrain(string) error
+	// OnRemove sets function called after server is removed, so connections to it can be closed.
+	// Expired is set when draining server was removed by drain timeout and its requests in flight must be canceled
+	OnRemove(func(server string, expired bool))
+	// SetCircuit sets state of circuit breaker of server, server with open circuit gets no requests
+	SetCircuit(server, state string)
+}
+
+// Backend is a state of server in pool, only healthy servers which are not draining and have no open circuit get requests.
+// Weight is a share of requests server gets relative to the others, it is below 1 during slow start.
+// Circuit is empty when circuit breaker has not seen server yet. Since is when health or draining of server changed last time
+type Backend struct {
+	URL       string    `json:"url"`
+	Healthy   bool      `json:"healthy"`
+	Draining  bool      `json:"draining"`
+	Circuit   string    `json:"circuit,omitempty"`
+	Weight    float64   `json:"weight"`
+	InFlight  int64     `json:"in_flight"`
+	Requests  int64     `json:"requests"`
+	CheckedAt time.Time `json:"checked_at"`
+	Since     time.Time `json:"since"`
+}
+
+type Option func(*options)
+
+type options struct {
+	drainTimeout time.Duration
+	slowStart    time.Duration
+	minWeight    float64
+}
+
+// WithDrainTimeout sets how long draining server waits for its requests before it is removed, 30s by default
+func WithDrainTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.drainTimeout = d
+	}
+}
+
+// WithSlowStart ramps weight of recovered or added server linearly from minWeight up to 1 within window,
+// zero window disables slow start
+func WithSlowStart(window time.Duration, minWeight float64) Option {
+	return func(o *options) {
+		o.slowStart = window
+		o.minWeight = minWeight
+	}
 }
@@ -5,105 +5,344 @@ import (
 	"fmt"
 	"net/url"
 	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+// circuit states are set by circuit breaker, pool only needs to tell open and closed ones
+const (
+	circuitOpen   = "open"
+	circuitClosed = "closed"
 )
 
+type backend struct {
+	Backend
+	// current is a smooth weighted round-robin counter, server with the greatest one gets the request
+	current float64
+	// rampStart is when slow start of server began, zero means server has full weight
+	rampStart time.Time
+	// drainTimer removes draining server when drain timeout passes
+	drainTimer *time.Timer
+}
+
+// RoundRobinPool spreads requests by smooth weighted round-robin, so servers in slow start
+// get fewer requests without bursts. Servers with equal weights get requests in turn
 type RoundRobinPool struct {
-	mu         sync.RWMutex
-	urls       []string
-	healthy    map[string]bool
-	idx        int
-	aliveCount int
+	mu       sync.RWMutex
+	servers  []*backend
+	opts     options
+	onRemove func(string, bool)
 }
 
-func NewRoundRobinPool(servers []string) (*RoundRobinPool, error) {
-	urls := make([]string, len(servers))
-	healthy := make(map[string]bool, len(servers))
+func NewRoundRobinPool(servers []string, opts ...Option) (*RoundRobinPool, error) {
+	p := &RoundRobinPool{
+		servers:  make([]*backend, 0, len(servers)),
+		opts:     options{drainTimeout: 30 * time.Second},
+		onRemove: func(string, bool) {},
+	}
+	for _, opt := range opts {
+		opt(&p.opts)
+	}
 
-	for i, s := range servers {
+	for _, s := range servers {
 		_, err := url.Parse(s)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse server '%s': %v", s, err)
 		}
 
-		urls[i] = s
-		healthy[s] = true
+		p.servers = append(p.servers, newBackend(s))
 	}
 
-	return &RoundRobinPool{
-		urls:       urls,
-		healthy:    healthy,
-		aliveCount: len(urls),
-	}, nil
+	return p, nil
 }
 
-func (p *RoundRobinPool) Get() (string, error) {
+func newBackend(server string) *backend {
+	return &backend{Backend: Backend{URL: server, Healthy: true, Weight: 1, Since: time.Now()}}
+}
+
+func (p *RoundRobinPool) Get() (string, func(), error) {
+	return p.Pick(nil)
+}
+
+// Pick works as Get but offers picked server to allow first, rejected server is skipped in favour of the next one.
+// Allow is called under the lock of pool, so it must not call pool
+func (p *RoundRobinPool) Pick(allow func(server string) bool) (string, func(), error) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	if p.idx >= p.aliveCount {
-		p.idx = 0
-	}
+	now := time.Now()
+	total := 0.0
+	candidates := make([]*backend, 0, len(p.servers))
+	for _, b := range p.servers {
+		if !b.Healthy || b.Draining || b.Circuit == circuitOpen {
+			continue
+		}
 
-	aliveIdx := 0
-	for i := range p.urls {
-		if p.healthy[p.urls[i]] && aliveIdx == p.idx {
-			p.idx++
+		w := p.weight(b, now)
+		b.current += w
+		total += w
+		candidates = append(candidates, b)
+	}
 
-			return p.urls[i], nil
+	var best *backend
+	for best == nil && len(candidates) > 0 {
+		i := 0
+		for j, b := range candidates {
+			if b.current > candidates[i].current {
+				i = j
+			}
 		}
 
-		if p.healthy[p.urls[i]] {
-			aliveIdx++
+		if allow == nil || allow(candidates[i].URL) {
+			best = candidates[i]
 		}
+		candidates = append(candidates[:i], candidates[i+1:]...)
 	}
 
-	return "", errors.New("no server was found")
+	if best == nil {
+		return "", nil, errors.New("no server was found")
+	}
+
+	best.current -= total
+	best.Requests++
+	best.InFlight++
+
+	return best.URL, func() { p.done(best) }, nil
+}
+
+// weight returns weight of b at now, during slow start it rises linearly from min weight up to 1
+func (p *RoundRobinPool) weight(b *backend, now time.Time) float64 {
+	if p.opts.slowStart <= 0 || b.rampStart.IsZero() {
+		return 1
+	}
+
+	elapsed := now.Sub(b.rampStart)
+	if elapsed >= p.opts.slowStart {
+		b.rampStart = time.Time{}
+		return 1
+	}
+
+	return p.opts.minWeight + (1-p.opts.minWeight)*float64(elapsed)/float64(p.opts.slowStart)
+}
+
+// startRamp begins slow start of b, caller must hold the lock
+func (b *backend) startRamp(now time.Time) {
+	b.rampStart = now
+	b.current = 0
+}
+
+// done finishes request to b, draining server is removed with its last request
+func (p *RoundRobinPool) done(b *backend) {
+	p.mu.Lock()
+	b.InFlight--
+	removed := b.Draining && b.InFlight == 0 && p.remove(b)
+	onRemove := p.onRemove
+	p.mu.Unlock()
+
+	if removed {
+		onRemove(b.URL, false)
+	}
 }
 
 // GetAll return URLs of all alive and dead servers
 func (p *RoundRobinPool) GetAll() []string {
-	res := make([]string, len(p.urls))
-
 	p.mu.RLock()
 	defer p.mu.RUnlock()
 
-	copy(res, p.urls)
+	res := make([]string, len(p.servers))
+	for i, b := range p.servers {
+		res[i] = b.URL
+	}
 
 	return res
 }
 
 // Enable returns true if server were marked as dead before
 func (p *RoundRobinPool) Enable(server string) bool {
+	return p.setHealthy(server, true)
+}
+
+// Disable returns true if server were marked as alive before
+func (p *RoundRobinPool) Disable(server string) bool {
+	return p.setHealthy(server, false)
+}
+
+func (p *RoundRobinPool) setHealthy(server string, healthy bool) bool {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	prev, ok := p.healthy[server]
-	if !ok {
+	b := p.find(server)
+	if b == nil || b.Draining {
+		return false
+	}
+
+	now := time.Now()
+	b.CheckedAt = now
+	if b.Healthy == healthy {
 		return false
 	}
 
-	if !prev {
-		p.aliveCount++
+	b.Healthy = healthy
+	b.Since = now
+	if healthy {
+		b.startRamp(now)
 	}
-	p.healthy[server] = true
 
-	return !prev
+	return true
 }
 
-// Disable returns true if server were marked as alive before
-func (p *RoundRobinPool) Disable(server string) bool {
+func (p *RoundRobinPool) Backends() []Backend {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 
-	prev, ok := p.healthy[server]
-	if !ok {
-		return false
+	now := time.Now()
+	res := make([]Backend, len(p.servers))
+	for i, b := range p.servers {
+		res[i] = b.Backend
+		res[i].Weight = p.weight(b, now)
 	}
 
-	if prev {
-		p.aliveCount--
+	return res
+}
+
+func (p *RoundRobinPool) Add(server string) error {
+	u, err := url.Parse(server)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return fmt.Errorf("failed to parse server '%s'", server)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.find(server) != nil {
+		return fmt.Errorf("server %w", model.ErrConflict)
+	}
+
+	b := newBackend(server)
+	b.startRamp(b.Since)
+	p.servers = append(p.servers, b)
+
+	return nil
+}
+
+// Remove removes server at once, its requests in flight are not interrupted and finish on their own
+func (p *RoundRobinPool) Remove(server string) error {
+	p.mu.Lock()
+	b := p.find(server)
+	removed := b != nil && p.remove(b)
+	onRemove := p.onRemove
+	p.mu.Unlock()
+
+	if !removed {
+		return fmt.Errorf("server %w", model.ErrNotFound)
+	}
+
+	onRemove(server, false)
+	return nil
+}
+
+// Drain removes server at once when it has no requests in flight
+func (p *RoundRobinPool) Drain(server string) error {
+	p.mu.Lock()
+	b := p.find(server)
+	if b == nil {
+		p.mu.Unlock()
+		return fmt.Errorf("server %w", model.ErrNotFound)
+	}
+
+	if !b.Draining {
+		b.Draining = true
+		b.Since = time.Now()
+		b.drainTimer = time.AfterFunc(p.opts.drainTimeout, func() {
+			p.mu.Lock()
+			removed := b.Draining && p.remove(b)
+			onRemove := p.onRemove
+			p.mu.Unlock()
+
+			if removed {
+				onRemove(b.URL, true)
+			}
+		})
+	}
+
+	removed := b.InFlight == 0 && p.remove(b)
+	onRemove := p.onRemove
+	p.mu.Unlock()
+
+	if removed {
+		onRemove(server, false)
+	}
+
+	return nil
+}
+
+func (p *RoundRobinPool) Undrain(server string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.find(server)
+	if b == nil {
+		return fmt.Errorf("server %w", model.ErrNotFound)
+	}
+
+	if b.Draining {
+		b.drainTimer.Stop()
+		b.Draining = false
+		b.Since = time.Now()
+	}
+
+	return nil
+}
+
+// SetCircuit ramps weight of server up again when its circuit closes
+func (p *RoundRobinPool) SetCircuit(server, state string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	b := p.find(server)
+	if b == nil || b.Circuit == state {
+		return
+	}
+
+	if state == circuitClosed && b.Circuit != "" {
+		b.startRamp(time.Now())
+	}
+	b.Circuit = state
+}
+
+func (p *RoundRobinPool) OnRemove(fn func(string, bool)) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.onRemove = fn
+}
+
+// remove removes b from pool and returns false when it was removed before, caller must hold the lock
+func (p *RoundRobinPool) remove(b *backend) bool {
+	for i, s := range p.servers {
+		if s != b {
+			continue
+		}
+
+		if b.drainTimer != nil {
+			b.drainTimer.Stop()
+		}
+		p.servers = append(p.servers[:i], p.servers[i+1:]...)
+
+		return true
+	}
+
+	return false
+}
+
+// find returns server by URL, caller must hold the lock
+func (p *RoundRobinPool) find(server string) *backend {
+	for _, b := range p.servers {
+		if b.URL == server {
+			return b
+		}
 	}
-	p.healthy[server] = false
 
-	return prev
+	return nil
 }
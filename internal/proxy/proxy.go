@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/config"
+)
+
+type Pooler interface {
+	Get() (string, func(), error)
+}
+
+type targetKey struct{}
+
+// Proxy forwards requests to upstream servers taken from pool.
+// Bodies are streamed in both directions and every upstream call is bounded by request timeout
+type Proxy struct {
+	rp      *httputil.ReverseProxy
+	pool    Pooler
+	targets map[string]*url.URL
+	timeout time.Duration
+	l       *slog.Logger
+}
+
+func New(cfg config.Upstream, pool Pooler, l *slog.Logger) (*Proxy, error) {
+	if pool == nil || l == nil {
+		return nil, errors.New("nil values in Proxy constructor")
+	}
+
+	targets := make(map[string]*url.URL, len(cfg.Servers))
+	for _, s := range cfg.Servers {
+		u, err := url.Parse(s)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("failed to parse upstream '%s'", s)
+		}
+		targets[s] = u
+	}
+
+	p := &Proxy{
+		pool:    pool,
+		targets: targets,
+		timeout: cfg.RequestTimeout,
+		l:       l,
+	}
+
+	p.rp = &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			target := pr.In.Context().Value(targetKey{}).(*url.URL)
+			pr.SetURL(target)
+			if cfg.PreserveHost {
+				pr.Out.Host = pr.In.Host
+			}
+
+			// keep forwarding chain of the proxies in front of us
+			pr.Out.Header["X-Forwarded-For"] = pr.In.Header["X-Forwarded-For"]
+			pr.SetXForwarded()
+		},
+		Transport: &http.Transport{
+			Proxy: http.ProxyFromEnvironment,
+			DialContext: (&net.Dialer{
+				Timeout:   cfg.DialTimeout,
+				KeepAlive: 30 * time.Second,
+			}).DialContext,
+			ForceAttemptHTTP2:     true,
+			MaxIdleConnsPerHost:   100,
+			IdleConnTimeout:       cfg.IdleTimeout,
+			ResponseHeaderTimeout: cfg.ResponseHeaderTimeout,
+			TLSHandshakeTimeout:   10 * time.Second,
+			ExpectContinueTimeout: time.Second,
+		},
+		// flush immediately so streamed responses are not buffered
+		FlushInterval: -1,
+		ErrorHandler:  p.handleError,
+	}
+
+	return p, nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server, done, err := p.pool.Get()
+	if err != nil {
+		// no healthy upstream is a temporary condition, so clients may retry
+		p.l.Warn(err.Error())
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	defer done()
+
+	target, ok := p.targets[server]
+	if !ok {
+		p.l.Error("unknown upstream received from pool", slog.String("upstream", server))
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	ctx := context.WithValue(r.Context(), targetKey{}, target)
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	p.rp.ServeHTTP(w, r.WithContext(ctx))
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(r.Context().Err(), context.Canceled):
+		// client has gone away, nobody is waiting for the response
+		p.l.Debug("client canceled request", slog.String("path", r.URL.Path))
+	case errors.Is(err, context.DeadlineExceeded) || isTimeout(err):
+		p.l.Warn("upstream timed out", slog.String("upstream", r.URL.Host), slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusGatewayTimeout)
+	default:
+		p.l.Error("upstream request failed", slog.String("upstream", r.URL.Host), slog.String("error", err.Error()))
+		w.WriteHeader(http.StatusBadGateway)
+	}
+}
+
+func isTimeout(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,320 @@
+package quota
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+// limitsTTL is how long loaded limits and usage are trusted before being loaded again
+const limitsTTL = 5 * time.Minute
+
+type Servicer interface {
+	GetQuota(token string) (model.Quota, error)
+	GetUsage(token string, day, month time.Time) (int64, int64, error)
+	AddUsage(deltas []model.QuotaUsage) ([]model.QuotaUsage, error)
+}
+
+type entry struct {
+	daily        int64
+	monthly      int64
+	dailyLimit   int64
+	monthlyLimit int64
+	day          time.Time
+	month        time.Time
+	loadedAt     time.Time
+	// usage of keys without stored token is counted in memory only, so anonymous keys do not fill storage
+	stored bool
+}
+
+type usageKey struct {
+	token  string
+	period string
+	start  string
+}
+
+// Counter enforces daily and monthly quotas. Usage is counted in memory
+// and flushed to storage in batches every flush interval
+type Counter struct {
+	defaultDaily   int64
+	defaultMonthly int64
+	location       *time.Location
+	entries        map[string]*entry
+	pending        map[usageKey]int64
+	mu             sync.Mutex
+	ticker         *time.Ticker
+	done           chan struct{}
+	stopped        chan struct{}
+	service        Servicer
+	l              *slog.Logger
+}
+
+// New creates counter, zero default limit means no limit. Service may be nil when usage should not be stored
+func New(defaultDaily, defaultMonthly int64, location *time.Location, flushInterval time.Duration, service Servicer, l *slog.Logger) *Counter {
+	c := &Counter{
+		defaultDaily:   defaultDaily,
+		defaultMonthly: defaultMonthly,
+		location:       location,
+		entries:        make(map[string]*entry),
+		pending:        make(map[usageKey]int64),
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+		service:        service,
+		l:              l,
+	}
+
+	c.ticker = time.NewTicker(flushInterval)
+	go c.run()
+
+	return c
+}
+
+func (c *Counter) run() {
+	defer close(c.stopped)
+
+	for {
+		select {
+		case <-c.ticker.C:
+			c.flush()
+		case <-c.done:
+			c.flush()
+			return
+		}
+	}
+}
+
+// Take counts cost against quotas of key, it returns exceeded period or empty string if cost was counted
+func (c *Counter) Take(key string, cost int) string {
+	e := c.entry(key)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	day, month := c.periods()
+	c.roll(e, day, month)
+
+	n := int64(cost)
+	if e.dailyLimit > 0 && e.daily+n > e.dailyLimit {
+		return model.PeriodDay
+	}
+	if e.monthlyLimit > 0 && e.monthly+n > e.monthlyLimit {
+		return model.PeriodMonth
+	}
+
+	c.add(key, e, n)
+	return ""
+}
+
+// Refund returns cost taken by request which was rejected afterwards
+func (c *Counter) Refund(key string, cost int) {
+	c.adjust(key, -int64(cost))
+}
+
+// Debit counts cost reported after the fact, usage may go over the quota
+func (c *Counter) Debit(key string, cost int) {
+	c.adjust(key, int64(cost))
+}
+
+// adjust changes usage of key which has taken cost before
+func (c *Counter) adjust(key string, n int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return
+	}
+
+	day, month := c.periods()
+	c.roll(e, day, month)
+	c.add(key, e, n)
+}
+
+// add must be called under mutex
+func (c *Counter) add(key string, e *entry, n int64) {
+	e.daily += n
+	e.monthly += n
+
+	if c.service != nil && e.stored {
+		c.pending[usageKey{token: key, period: model.PeriodDay, start: e.day.Format(time.DateOnly)}] += n
+		c.pending[usageKey{token: key, period: model.PeriodMonth, start: e.month.Format(time.DateOnly)}] += n
+	}
+}
+
+// roll resets usage of entry when a new period has started, must be called under mutex
+func (c *Counter) roll(e *entry, day, month time.Time) {
+	if !e.day.Equal(day) {
+		e.day = day
+		e.daily = 0
+	}
+	if !e.month.Equal(month) {
+		e.month = month
+		e.monthly = 0
+	}
+}
+
+func (c *Counter) periods() (time.Time, time.Time) {
+	now := time.Now().In(c.location)
+	day := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, c.location)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, c.location)
+
+	return day, month
+}
+
+// entry returns cached entry of key or loads it from storage
+func (c *Counter) entry(key string) *entry {
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && time.Since(e.loadedAt) < limitsTTL {
+		return e
+	}
+
+	day, month := c.periods()
+	loaded := &entry{
+		dailyLimit:   c.defaultDaily,
+		monthlyLimit: c.defaultMonthly,
+		day:          day,
+		month:        month,
+		loadedAt:     time.Now(),
+	}
+
+	if c.service != nil {
+		q, err := c.service.GetQuota(key)
+		switch {
+		case err == nil:
+			loaded.stored = true
+			if q.Daily != nil {
+				loaded.dailyLimit = *q.Daily
+			}
+			if q.Monthly != nil {
+				loaded.monthlyLimit = *q.Monthly
+			}
+		case !errors.Is(err, model.ErrNotFound):
+			// token may exist, its usage must not be lost while storage is unavailable
+			loaded.stored = true
+		}
+	}
+
+	if loaded.stored {
+		daily, monthly, err := c.service.GetUsage(key, day, month)
+		if err != nil {
+			c.l.Error(fmt.Sprintf("failed to load quota usage: %v", err))
+		}
+		loaded.daily = daily
+		loaded.monthly = monthly
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ok {
+		// keep usage counted locally while entry was being loaded
+		c.roll(e, day, month)
+		loaded.daily = max(loaded.daily, e.daily)
+		loaded.monthly = max(loaded.monthly, e.monthly)
+		*e = *loaded
+		return e
+	}
+	if cur, ok := c.entries[key]; ok {
+		return cur
+	}
+
+	// usage which is not flushed yet is not in storage
+	c.addPending(key, loaded)
+	c.entries[key] = loaded
+	return loaded
+}
+
+// addPending adds unflushed usage of key to entry, must be called under mutex
+func (c *Counter) addPending(key string, e *entry) {
+	e.daily += c.pending[usageKey{token: key, period: model.PeriodDay, start: e.day.Format(time.DateOnly)}]
+	e.monthly += c.pending[usageKey{token: key, period: model.PeriodMonth, start: e.month.Format(time.DateOnly)}]
+}
+
+func (c *Counter) flush() {
+	if c.service == nil {
+		c.cleanup()
+		return
+	}
+
+	c.mu.Lock()
+	pending := c.pending
+	c.pending = make(map[usageKey]int64)
+	c.mu.Unlock()
+
+	deltas := make([]model.QuotaUsage, 0, len(pending))
+	for k, n := range pending {
+		if n == 0 {
+			continue
+		}
+
+		start, err := time.ParseInLocation(time.DateOnly, k.start, c.location)
+		if err != nil {
+			continue
+		}
+		deltas = append(deltas, model.QuotaUsage{Token: k.token, Period: k.period, PeriodStart: start, Used: n})
+	}
+	if len(deltas) == 0 {
+		c.cleanup()
+		return
+	}
+
+	totals, err := c.service.AddUsage(deltas)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err != nil {
+		c.l.Error(fmt.Sprintf("failed to flush quota usage: %v", err))
+		for k, n := range pending {
+			c.pending[k] += n
+		}
+		return
+	}
+
+	// totals include usage of other instances
+	for _, t := range totals {
+		e, ok := c.entries[t.Token]
+		if !ok {
+			continue
+		}
+
+		k := usageKey{token: t.Token, period: t.Period, start: t.PeriodStart.Format(time.DateOnly)}
+		switch {
+		case t.Period == model.PeriodDay && k.start == e.day.Format(time.DateOnly):
+			e.daily = t.Used + c.pending[k]
+		case t.Period == model.PeriodMonth && k.start == e.month.Format(time.DateOnly):
+			e.monthly = t.Used + c.pending[k]
+		}
+	}
+
+	c.cleanupLocked()
+}
+
+func (c *Counter) cleanup() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.cleanupLocked()
+}
+
+// cleanupLocked drops entries which were not loaded for a long time, must be called under mutex
+func (c *Counter) cleanupLocked() {
+	for key, e := range c.entries {
+		if time.Since(e.loadedAt) > 2*limitsTTL {
+			delete(c.entries, key)
+		}
+	}
+}
+
+// Stop flushes pending usage and stops counter
+func (c *Counter) Stop() {
+	c.ticker.Stop()
+	close(c.done)
+	<-c.stopped
+}
@@ -0,0 +1,36 @@
+package ratelimiter
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Arzeeq/cloud-camp/internal/config"
+)
+
+// CostFunc returns how many tokens request takes before it is served
+type CostFunc func(r *http.Request) int
+
+func NewCostFunc(cfg config.Cost) CostFunc {
+	base := cfg.Default
+	if base <= 0 {
+		base = 1
+	}
+
+	methods := make(map[string]int, len(cfg.Methods))
+	for m, c := range cfg.Methods {
+		methods[strings.ToUpper(m)] = c
+	}
+
+	return func(r *http.Request) int {
+		cost := base
+		if c, ok := methods[r.Method]; ok {
+			cost = c
+		}
+
+		if cfg.PerKB > 0 && r.ContentLength > 0 {
+			cost += cfg.PerKB * int((r.ContentLength+1023)/1024)
+		}
+
+		return cost
+	}
+}
@@ -0,0 +1,107 @@
+package ratelimiter
+
+import (
+	"strings"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+const (
+	CodeOK        = "OK"
+	CodeOverLimit = "OVER_LIMIT"
+)
+
+// KeyTypeAPIKey marks key of descriptor as API key, keys of other types such as IP are not validated as issued ones
+const KeyTypeAPIKey = "api_key"
+
+// Descriptor describes request which external proxy asks decision for, zero cost means 1 and empty key type is API key
+type Descriptor struct {
+	Key     string `json:"key"`
+	KeyType string `json:"key_type"`
+	Route   string `json:"route"`
+	Method  string `json:"method"`
+	Cost    int    `json:"cost"`
+}
+
+// Status is a decision for descriptor. Remaining is -1 when no policy limits the descriptor
+type Status struct {
+	Code       string `json:"code"`
+	Policy     string `json:"policy,omitempty"`
+	Remaining  int    `json:"remaining"`
+	RetryAfter int    `json:"retry_after,omitempty"`
+	Reason     string `json:"reason,omitempty"`
+}
+
+// Decide checks descriptor the same way middleware checks request and takes its cost when allowed.
+// Caller does not report when request is finished, so concurrency limits and queues are not applied
+func (rl *RateLimiter) Decide(d Descriptor) Status {
+	var p *Policy
+	for _, candidate := range rl.policies {
+		if candidate.Mode != ModeShadow && candidate.Match(strings.ToUpper(d.Method), d.Route) {
+			p = candidate
+			break
+		}
+	}
+
+	if p == nil {
+		return Status{Code: CodeOK, Remaining: -1}
+	}
+
+	d.Key = rl.hash(d.Key)
+
+	if rl.access != nil {
+		switch rl.access.Check(d.Key, nil) {
+		case model.ListDeny:
+			rl.record(d.Key, false)
+			return Status{Code: CodeOverLimit, Policy: p.Name, Reason: "access denied"}
+		case model.ListAllow:
+			return Status{Code: CodeOK, Policy: p.Name, Remaining: -1}
+		}
+	}
+
+	if rl.keys != nil && (d.KeyType == "" || d.KeyType == KeyTypeAPIKey) {
+		if err := rl.keys.Validate(d.Key); err != nil {
+			rl.record(d.Key, false)
+			return Status{Code: CodeOverLimit, Policy: p.Name, Reason: err.Error()}
+		}
+	}
+
+	if rl.penalty != nil {
+		if until, banned := rl.penalty.Banned(d.Key); banned {
+			rl.record(d.Key, false)
+			return Status{
+				Code:       CodeOverLimit,
+				Policy:     p.Name,
+				RetryAfter: int(time.Until(until).Seconds()) + 1,
+				Reason:     "key is temporarily banned",
+			}
+		}
+	}
+
+	cost := max(1, d.Cost)
+	if rl.quota != nil {
+		if period := rl.quota.Take(d.Key, cost); period != "" {
+			rl.record(d.Key, false)
+			reason := "monthly quota exceeded"
+			if period == model.PeriodDay {
+				reason = "daily quota exceeded"
+			}
+
+			return Status{Code: CodeOverLimit, Policy: p.Name, Reason: reason}
+		}
+	}
+
+	allowed := p.Bucket.TakeN(d.Key, cost)
+	rl.record(d.Key, allowed)
+	if allowed {
+		return Status{Code: CodeOK, Policy: p.Name, Remaining: p.Bucket.Remaining(d.Key)}
+	}
+
+	if rl.quota != nil {
+		rl.quota.Refund(d.Key, cost)
+	}
+	rl.strike(d.Key)
+
+	return Status{Code: CodeOverLimit, Policy: p.Name, Reason: "rate limit exceeded"}
+}
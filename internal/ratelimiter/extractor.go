@@ -0,0 +1,386 @@
+package ratelimiter
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/config"
+)
+
+const (
+	ExtractorHeader    = "header"
+	ExtractorIP        = "ip"
+	ExtractorJWT       = "jwt"
+	ExtractorPath      = "path"
+	ExtractorComposite = "composite"
+)
+
+var ErrNoKey = errors.New("no rate limit key in request")
+
+// Extractor returns the key which request is limited by
+type Extractor interface {
+	Extract(r *http.Request) (string, error)
+}
+
+type ExtractorFunc func(r *http.Request) (string, error)
+
+func (f ExtractorFunc) Extract(r *http.Request) (string, error) {
+	return f(r)
+}
+
+// APIKeyExtractor also reports whether key is an API key, that is a header value taken as is.
+// Only API keys are validated as issued ones, keys of other extractors are never issued
+type APIKeyExtractor interface {
+	Extractor
+	ExtractAPIKey(r *http.Request) (string, bool, error)
+}
+
+// extract returns key and whether it is an API key
+func extract(e Extractor, r *http.Request) (string, bool, error) {
+	if ae, ok := e.(APIKeyExtractor); ok {
+		return ae.ExtractAPIKey(r)
+	}
+
+	key, err := e.Extract(r)
+	return key, false, err
+}
+
+// NewExtractor builds a chain from config, X-API-Key header is used when nothing is configured
+func NewExtractor(cfgs []config.KeyExtractor) (Extractor, error) {
+	if len(cfgs) == 0 {
+		return HeaderExtractor("X-API-Key"), nil
+	}
+
+	extractors := make([]Extractor, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		e, err := newExtractor(cfg)
+		if err != nil {
+			return nil, err
+		}
+		extractors = append(extractors, e)
+	}
+
+	return Chain(extractors...), nil
+}
+
+func newExtractor(cfg config.KeyExtractor) (Extractor, error) {
+	var e Extractor
+	switch cfg.Type {
+	case ExtractorHeader:
+		if cfg.Header == "" {
+			return nil, errors.New("header extractor requires header name")
+		}
+		e = HeaderExtractor(cfg.Header)
+	case ExtractorIP:
+		trusted, err := ParseCIDRs(cfg.TrustedProxies)
+		if err != nil {
+			return nil, err
+		}
+		e = IPExtractor(trusted)
+	case ExtractorJWT:
+		if cfg.Claim == "" {
+			return nil, errors.New("jwt extractor requires claim name")
+		}
+		var secret []byte
+		if cfg.SecretEnv != "" {
+			secret = []byte(os.Getenv(cfg.SecretEnv))
+			if len(secret) == 0 {
+				return nil, fmt.Errorf("jwt secret variable '%s' is empty", cfg.SecretEnv)
+			}
+		}
+		e = JWTClaimExtractor(cfg.Header, cfg.Claim, secret)
+	case ExtractorPath:
+		e = PathExtractor()
+	case ExtractorComposite:
+		if len(cfg.Parts) == 0 {
+			return nil, errors.New("composite extractor requires parts")
+		}
+		parts := make([]Extractor, 0, len(cfg.Parts))
+		for _, p := range cfg.Parts {
+			part, err := newExtractor(p)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part)
+		}
+		e = CompositeExtractor(parts...)
+	default:
+		return nil, fmt.Errorf("unexpected key extractor type '%s'", cfg.Type)
+	}
+
+	if cfg.Prefix != "" {
+		e = Prefixed(cfg.Prefix, e)
+	}
+
+	return e, nil
+}
+
+// ParseCIDRs accepts CIDRs and single IPs
+func ParseCIDRs(values []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(values))
+	for _, v := range values {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CIDR '%s': %w", v, err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+type chain []Extractor
+
+// Chain returns the key of the first extractor that succeeds
+func Chain(extractors ...Extractor) Extractor {
+	return chain(extractors)
+}
+
+func (c chain) Extract(r *http.Request) (string, error) {
+	key, _, err := c.ExtractAPIKey(r)
+	return key, err
+}
+
+func (c chain) ExtractAPIKey(r *http.Request) (string, bool, error) {
+	for _, e := range c {
+		if key, apiKey, err := extract(e, r); err == nil {
+			return key, apiKey, nil
+		}
+	}
+
+	return "", false, ErrNoKey
+}
+
+// CompositeExtractor joins keys of all parts, every part is required
+func CompositeExtractor(parts ...Extractor) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		keys := make([]string, 0, len(parts))
+		for _, p := range parts {
+			key, err := p.Extract(r)
+			if err != nil {
+				return "", err
+			}
+			keys = append(keys, key)
+		}
+
+		return strings.Join(keys, ":"), nil
+	})
+}
+
+func Prefixed(prefix string, e Extractor) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		key, err := e.Extract(r)
+		if err != nil {
+			return "", err
+		}
+
+		return prefix + key, nil
+	})
+}
+
+type headerExtractor string
+
+// HeaderExtractor takes API key from header, prefixed header value is not an API key anymore
+func HeaderExtractor(name string) Extractor {
+	return headerExtractor(name)
+}
+
+func (h headerExtractor) Extract(r *http.Request) (string, error) {
+	key := r.Header.Get(string(h))
+	if key == "" {
+		return "", ErrNoKey
+	}
+
+	return key, nil
+}
+
+func (h headerExtractor) ExtractAPIKey(r *http.Request) (string, bool, error) {
+	key, err := h.Extract(r)
+	return key, err == nil, err
+}
+
+func PathExtractor() Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		return r.URL.Path, nil
+	})
+}
+
+// IPExtractor uses X-Forwarded-For only when request came from trusted proxy
+func IPExtractor(trusted []*net.IPNet) Extractor {
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		ip, err := ClientIP(r, trusted)
+		if err != nil {
+			return "", err
+		}
+		if ip == nil {
+			return "", ErrNoKey
+		}
+
+		return ip.String(), nil
+	})
+}
+
+// ClientIP walks X-Forwarded-For from the right skipping trusted proxies. Hop which can not be parsed
+// is reported as ErrNoKey, so clients behind the proxy which sent it are not keyed by its address
+func ClientIP(r *http.Request, trusted []*net.IPNet) (net.IP, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil || !isTrusted(ip, trusted) {
+		return ip, nil
+	}
+
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := net.ParseIP(strings.TrimSpace(hops[i]))
+		if hop == nil {
+			return nil, fmt.Errorf("X-Forwarded-For hop %d can not be parsed: %w", i, ErrNoKey)
+		}
+
+		ip = hop
+		if !isTrusted(hop, trusted) {
+			break
+		}
+	}
+
+	return ip, nil
+}
+
+func isTrusted(ip net.IP, trusted []*net.IPNet) bool {
+	for _, n := range trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// JWTClaimExtractor reads claim from bearer token, signature is verified only when secret is set
+func JWTClaimExtractor(header, claim string, secret []byte) Extractor {
+	if header == "" {
+		header = "Authorization"
+	}
+
+	return ExtractorFunc(func(r *http.Request) (string, error) {
+		token := strings.TrimSpace(r.Header.Get(header))
+		if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+			token = strings.TrimSpace(token[7:])
+		}
+		if token == "" {
+			return "", ErrNoKey
+		}
+
+		claims, err := parseJWT(token, secret)
+		if err != nil {
+			return "", err
+		}
+
+		switch v := claims[claim].(type) {
+		case string:
+			if v != "" {
+				return v, nil
+			}
+		case json.Number:
+			return v.String(), nil
+		}
+
+		return "", fmt.Errorf("claim '%s' not found in token", claim)
+	})
+}
+
+func parseJWT(token string, secret []byte) (map[string]any, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+
+	if secret != nil {
+		var header struct {
+			Alg string `json:"alg"`
+		}
+		if err := decodeSegment(parts[0], &header); err != nil {
+			return nil, err
+		}
+
+		var h func() hash.Hash
+		switch header.Alg {
+		case "HS256":
+			h = sha256.New
+		case "HS384":
+			h = sha512.New384
+		case "HS512":
+			h = sha512.New
+		default:
+			return nil, fmt.Errorf("unsupported jwt algorithm '%s'", header.Alg)
+		}
+
+		signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode jwt signature: %w", err)
+		}
+
+		mac := hmac.New(h, secret)
+		mac.Write([]byte(parts[0] + "." + parts[1]))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("invalid jwt signature")
+		}
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, err
+	}
+
+	if secret != nil {
+		if exp, ok := claims["exp"].(json.Number); ok {
+			sec, err := exp.Int64()
+			if err != nil || time.Now().Unix() >= sec {
+				return nil, errors.New("jwt is expired")
+			}
+		}
+	}
+
+	return claims, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return fmt.Errorf("failed to decode jwt segment: %w", err)
+	}
+
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to parse jwt segment: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package ratelimiter
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Arzeeq/cloud-camp/internal/config"
+)
+
+// Policy limits requests matching method and path with its own bucket and key.
+// Policy without methods, prefix and regex matches every request
+type Policy struct {
+	Name       string
+	Mode       string
+	Methods    []string
+	Prefix     string
+	Regex      *regexp.Regexp
+	Extractor  Extractor
+	Bucket     Bucketer
+	Cost       CostFunc
+	CostHeader string
+	// InFlight limits concurrent requests per key, nil disables it
+	InFlight Limiter
+	// Queue delays requests exceeding the limit instead of rejecting them, nil disables it
+	Queue *Queue
+}
+
+// NewPolicy builds policy from rule, default extractor is used when rule has no key configured
+func NewPolicy(rule config.Rule, b Bucketer, defaultExtractor Extractor) (*Policy, error) {
+	p := &Policy{
+		Name:       rule.Name,
+		Mode:       rule.Mode,
+		Prefix:     rule.PathPrefix,
+		Extractor:  defaultExtractor,
+		Bucket:     b,
+		Cost:       NewCostFunc(rule.Cost),
+		CostHeader: rule.Cost.Header,
+	}
+
+	switch rule.Mode {
+	case "":
+		p.Mode = ModeEnforce
+	case ModeEnforce, ModeShadow:
+	default:
+		return nil, fmt.Errorf("unexpected mode '%s' of rule '%s'", rule.Mode, rule.Name)
+	}
+
+	if rule.Queue.Size > 0 {
+		p.Queue = NewQueue(rule.Queue.Size, rule.Queue.MaxWait)
+	}
+
+	for _, m := range rule.Methods {
+		p.Methods = append(p.Methods, strings.ToUpper(m))
+	}
+
+	if rule.PathRegex != "" {
+		re, err := regexp.Compile(rule.PathRegex)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile path regex of rule '%s': %w", rule.Name, err)
+		}
+		p.Regex = re
+	}
+
+	if len(rule.Key) > 0 {
+		e, err := NewExtractor(rule.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build key extractor of rule '%s': %w", rule.Name, err)
+		}
+		p.Extractor = e
+	}
+
+	return p, nil
+}
+
+func (p *Policy) Match(method, path string) bool {
+	if len(p.Methods) > 0 {
+		found := false
+		for _, m := range p.Methods {
+			if m == method {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if p.Prefix != "" && !strings.HasPrefix(path, p.Prefix) {
+		return false
+	}
+
+	if p.Regex != nil && !p.Regex.MatchString(path) {
+		return false
+	}
+
+	return true
+}
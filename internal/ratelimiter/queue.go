@@ -0,0 +1,102 @@
+package ratelimiter
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Queue delays requests exceeding the limit in bounded per key FIFO until tokens are refilled
+type Queue struct {
+	size    int
+	maxWait time.Duration
+	mu      sync.Mutex
+	waiters map[string][]chan struct{}
+}
+
+func NewQueue(size int, maxWait time.Duration) *Queue {
+	return &Queue{
+		size:    size,
+		maxWait: maxWait,
+		waiters: make(map[string][]chan struct{}),
+	}
+}
+
+// Wait blocks until cost tokens are taken from bucket. It returns false when queue is full,
+// max wait is over or ctx is done. Only the head of key's queue tries to take tokens
+func (q *Queue) Wait(ctx context.Context, b Bucketer, key string, cost int) bool {
+	turn, ok := q.enqueue(key)
+	if !ok {
+		return false
+	}
+	defer q.dequeue(key, turn)
+
+	timer := time.NewTimer(q.maxWait)
+	defer timer.Stop()
+
+	select {
+	case <-turn:
+	case <-timer.C:
+		return false
+	case <-ctx.Done():
+		return false
+	}
+
+	for {
+		// subscribe before taking so refill between them is not missed
+		refilled := b.Refilled()
+		if b.TakeN(key, cost) {
+			return true
+		}
+
+		select {
+		case <-refilled:
+		case <-timer.C:
+			return false
+		case <-ctx.Done():
+			return false
+		}
+	}
+}
+
+func (q *Queue) enqueue(key string) (chan struct{}, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if len(q.waiters[key]) >= q.size {
+		return nil, false
+	}
+
+	turn := make(chan struct{})
+	if len(q.waiters[key]) == 0 {
+		close(turn)
+	}
+	q.waiters[key] = append(q.waiters[key], turn)
+
+	return turn, true
+}
+
+// dequeue removes waiter and passes the turn to the next one if waiter was the head
+func (q *Queue) dequeue(key string, turn chan struct{}) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	waiters := q.waiters[key]
+	for i, w := range waiters {
+		if w != turn {
+			continue
+		}
+
+		waiters = append(waiters[:i], waiters[i+1:]...)
+		if i == 0 && len(waiters) > 0 {
+			close(waiters[0])
+		}
+		break
+	}
+
+	if len(waiters) == 0 {
+		delete(q.waiters, key)
+		return
+	}
+	q.waiters[key] = waiters
+}
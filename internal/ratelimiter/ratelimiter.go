@@ -1,10 +1,18 @@
 package ratelimiter
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
 )
 
 type response struct {
@@ -13,42 +21,362 @@ type response struct {
 }
 
 type Bucketer interface {
-	Take(token string) bool
+	TakeN(token string, cost int) bool
+	// Debit takes tokens after the fact even if it exceeds the limit
+	Debit(token string, n int)
+	Remaining(token string) int
+	// Refilled returns channel which is closed on the next refill
+	Refilled() <-chan struct{}
+}
+
+type Limiter interface {
+	// Acquire returns false if key has no free slot
+	Acquire(key string) bool
+	Release(key string)
+}
+
+type AccessChecker interface {
+	// Check returns list which key or ip belongs to, empty string when none
+	Check(key string, ip net.IP) string
+}
+
+type PenaltyBox interface {
+	// Banned returns end of the ban if key is banned now
+	Banned(key string) (time.Time, bool)
+	// Strike records rejection of key
+	Strike(key string)
+}
+
+type QuotaCounter interface {
+	// Take returns exceeded period or empty string if cost was counted
+	Take(key string, cost int) string
+	// Refund returns cost of request which was rejected afterwards
+	Refund(key string, cost int)
+	// Debit counts cost reported after the fact, it never rejects
+	Debit(key string, cost int)
+}
+
+type UsageRecorder interface {
+	Record(key string, allowed bool)
+}
+
+type KeyHasher interface {
+	Hash(key string) string
+}
+
+type KeyValidator interface {
+	// Validate returns model.ErrKeyExpired, model.ErrKeyRevoked, model.ErrKeyUnknown or model.ErrKeyUnverified
+	// for keys which can not be used
+	Validate(key string) error
 }
 
 type RateLimiter struct {
-	b Bucketer
-	l *slog.Logger
+	policies []*Policy
+	access   AccessChecker
+	trusted  []*net.IPNet
+	penalty  PenaltyBox
+	quota    QuotaCounter
+	usage    UsageRecorder
+	hasher   KeyHasher
+	keys     KeyValidator
+	l        *slog.Logger
 }
 
-func New(b Bucketer, l *slog.Logger) *RateLimiter {
-	return &RateLimiter{b: b, l: l}
+type Option func(rl *RateLimiter)
+
+// WithAccessLists checks client IP and key against allow and deny lists before the bucket.
+// Trusted proxies are used to find client IP in X-Forwarded-For
+func WithAccessLists(access AccessChecker, trusted []*net.IPNet) Option {
+	return func(rl *RateLimiter) {
+		rl.access = access
+		rl.trusted = trusted
+	}
+}
+
+// WithPenaltyBox rejects banned keys before the bucket and reports every rejection to the box
+func WithPenaltyBox(penalty PenaltyBox) Option {
+	return func(rl *RateLimiter) {
+		rl.penalty = penalty
+	}
+}
+
+// WithQuota enforces long-horizon quotas next to the bucket
+func WithQuota(quota QuotaCounter) Option {
+	return func(rl *RateLimiter) {
+		rl.quota = quota
+	}
+}
+
+// WithUsage records every decision made for a key
+func WithUsage(usage UsageRecorder) Option {
+	return func(rl *RateLimiter) {
+		rl.usage = usage
+	}
+}
+
+// WithKeyHasher replaces keys with their hashes before access lists are checked,
+// so access lists, buckets, quotas, bans and storage never see raw keys
+func WithKeyHasher(hasher KeyHasher) Option {
+	return func(rl *RateLimiter) {
+		rl.hasher = hasher
+	}
+}
+
+// WithKeyValidator rejects expired and revoked keys before the bucket
+func WithKeyValidator(keys KeyValidator) Option {
+	return func(rl *RateLimiter) {
+		rl.keys = keys
+	}
+}
+
+// New creates rate limiter, policies are evaluated in order and the first matching
+// enforced one is applied. Matching shadow policies before it are only evaluated
+func New(policies []*Policy, l *slog.Logger, opts ...Option) *RateLimiter {
+	rl := &RateLimiter{policies: policies, l: l}
+	for _, opt := range opts {
+		opt(rl)
+	}
+
+	return rl
 }
 
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		key := r.Header.Get("X-API-Key")
+		p, shadows := rl.match(r)
+
+		// without enforced policy the key of the first shadow one is still checked against access lists
+		keyPolicy := p
+		if keyPolicy == nil && rl.access != nil && len(shadows) > 0 {
+			keyPolicy = shadows[0]
+		}
+
+		var key string
+		var apiKey bool
+		var keyErr error
+		if keyPolicy != nil {
+			key, apiKey, keyErr = extract(keyPolicy.Extractor, r)
+		}
+
+		if rl.access != nil {
+			hash := ""
+			if key != "" {
+				hash = rl.hash(key)
+			}
+
+			// IP rules are skipped when client address is unknown
+			ip, _ := ClientIP(r, rl.trusted)
+			switch rl.access.Check(hash, ip) {
+			case model.ListDeny:
+				if hash != "" {
+					rl.record(hash, false)
+				}
+				rl.writeResponse(w, response{
+					Code:    http.StatusForbidden,
+					Message: "Access denied",
+				})
+				return
+			case model.ListAllow:
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		for _, shadow := range shadows {
+			defer rl.shadow(shadow, r)()
+		}
 
-		if key == "" {
+		if p == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if keyErr != nil {
+			rl.l.Debug("failed to extract rate limit key", slog.String("policy", p.Name), slog.String("error", keyErr.Error()))
 			rl.writeResponse(w, response{
 				Code:    http.StatusBadRequest,
-				Message: "No X-API-Key provided",
+				Message: "No rate limit key provided",
 			})
 			return
 		}
 
-		if rl.b.Take(key) {
-			next.ServeHTTP(w, r)
+		rl.enforce(p, key, apiKey, next, w, r)
+	})
+}
+
+// match returns the first matching enforced policy and matching shadow policies before it
+func (rl *RateLimiter) match(r *http.Request) (*Policy, []*Policy) {
+	var shadows []*Policy
+	for _, candidate := range rl.policies {
+		if !candidate.Match(r.Method, r.URL.Path) {
+			continue
+		}
+
+		if candidate.Mode == ModeShadow {
+			shadows = append(shadows, candidate)
+			continue
+		}
+
+		return candidate, shadows
+	}
+
+	return nil, shadows
+}
+
+// enforce applies policy to request which passed access lists, key is not hashed yet.
+// Only API keys are validated, keys such as IP are never issued
+func (rl *RateLimiter) enforce(p *Policy, key string, apiKey bool, next http.Handler, w http.ResponseWriter, r *http.Request) {
+	key = rl.hash(key)
+
+	if rl.keys != nil && apiKey {
+		if err := rl.keys.Validate(key); err != nil {
+			rl.record(key, false)
+			res := response{Code: http.StatusUnauthorized, Message: "API key has been revoked"}
+			switch {
+			case errors.Is(err, model.ErrKeyExpired):
+				res.Message = "API key has expired"
+			case errors.Is(err, model.ErrKeyUnknown):
+				res.Message = "API key was not issued"
+			case errors.Is(err, model.ErrKeyUnverified):
+				res = response{Code: http.StatusServiceUnavailable, Message: "API key can not be verified now"}
+			}
+
+			rl.writeResponse(w, res)
+			return
+		}
+	}
+
+	if rl.penalty != nil {
+		if until, banned := rl.penalty.Banned(key); banned {
+			rl.record(key, false)
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(until).Seconds())+1))
+			rl.writeResponse(w, response{
+				Code:    http.StatusTooManyRequests,
+				Message: "Key is temporarily banned",
+			})
+			return
+		}
+	}
+
+	if p.InFlight != nil {
+		if !p.InFlight.Acquire(key) {
+			rl.record(key, false)
+			rl.strike(key)
+			rl.writeResponse(w, response{
+				Code:    http.StatusTooManyRequests,
+				Message: "Too many concurrent requests",
+			})
 			return
 		}
 
-		rl.writeResponse(w, response{
-			Code:    http.StatusTooManyRequests,
-			Message: "Rate limit exceeded",
-		})
+		release := rl.release(r, p.InFlight, key)
+		defer release()
+	}
+
+	cost := 1
+	if p.Cost != nil {
+		cost = p.Cost(r)
+	}
+
+	if rl.quota != nil {
+		if period := rl.quota.Take(key, cost); period != "" {
+			rl.record(key, false)
+			message := "Monthly quota exceeded"
+			if period == model.PeriodDay {
+				message = "Daily quota exceeded"
+			}
+
+			rl.writeResponse(w, response{
+				Code:    http.StatusTooManyRequests,
+				Message: message,
+			})
+			return
+		}
+	}
+
+	var allowed bool
+	if p.Queue != nil {
+		allowed = p.Queue.Wait(r.Context(), p.Bucket, key, cost)
+	} else {
+		allowed = p.Bucket.TakeN(key, cost)
+	}
+
+	rl.record(key, allowed)
+	if allowed {
+		next.ServeHTTP(w, r)
+		rl.debit(w, p, key, cost)
+		return
+	}
+
+	if rl.quota != nil {
+		rl.quota.Refund(key, cost)
+	}
+
+	rl.strike(key)
+	rl.writeResponse(w, response{
+		Code:    http.StatusTooManyRequests,
+		Message: "Rate limit exceeded",
 	})
 }
 
+func (rl *RateLimiter) hash(key string) string {
+	if rl.hasher == nil {
+		return key
+	}
+
+	return rl.hasher.Hash(key)
+}
+
+func (rl *RateLimiter) record(key string, allowed bool) {
+	if rl.usage != nil {
+		rl.usage.Record(key, allowed)
+	}
+}
+
+func (rl *RateLimiter) strike(key string) {
+	if rl.penalty != nil {
+		rl.penalty.Strike(key)
+	}
+}
+
+// release frees the slot once request is finished or client has disconnected
+func (rl *RateLimiter) release(r *http.Request, limiter Limiter, key string) func() {
+	var once sync.Once
+	release := func() {
+		once.Do(func() { limiter.Release(key) })
+	}
+
+	stop := context.AfterFunc(r.Context(), release)
+	return func() {
+		stop()
+		release()
+	}
+}
+
+// debit takes the rest of the cost reported by upstream in response header from bucket and quota
+func (rl *RateLimiter) debit(w http.ResponseWriter, p *Policy, key string, taken int) {
+	if p.CostHeader == "" {
+		return
+	}
+
+	value := w.Header().Get(p.CostHeader)
+	if value == "" {
+		return
+	}
+
+	cost, err := strconv.Atoi(value)
+	if err != nil {
+		rl.l.Warn("upstream reported invalid cost", slog.String("policy", p.Name), slog.String("value", value))
+		return
+	}
+
+	if cost > taken {
+		p.Bucket.Debit(key, cost-taken)
+		if rl.quota != nil {
+			rl.quota.Debit(key, cost-taken)
+		}
+	}
+}
+
 func (rl *RateLimiter) writeResponse(w http.ResponseWriter, res response) {
 	w.Header().Add("Content-Type", "application/json")
 	w.WriteHeader(res.Code)
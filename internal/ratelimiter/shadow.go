@@ -0,0 +1,61 @@
+package ratelimiter
+
+import (
+	"expvar"
+	"log/slog"
+	"net/http"
+)
+
+const (
+	ModeEnforce = "enforce"
+	ModeShadow  = "shadow"
+)
+
+// shadowStats counts decisions of shadow policies as "<policy>.allowed" and "<policy>.rejected"
+var shadowStats = expvar.NewMap("ratelimiter_shadow")
+
+// shadow evaluates policy without rejecting request, returned function frees acquired slot
+func (rl *RateLimiter) shadow(p *Policy, r *http.Request) func() {
+	key, err := p.Extractor.Extract(r)
+	if err != nil {
+		shadowStats.Add(p.Name+".no_key", 1)
+		return func() {}
+	}
+	key = rl.hash(key)
+
+	release := func() {}
+	reason := ""
+	if p.InFlight != nil {
+		if p.InFlight.Acquire(key) {
+			release = rl.release(r, p.InFlight, key)
+		} else {
+			reason = "concurrency"
+		}
+	}
+
+	cost := 1
+	if p.Cost != nil {
+		cost = p.Cost(r)
+	}
+
+	if reason == "" && !p.Bucket.TakeN(key, cost) {
+		reason = "rate"
+	}
+
+	if reason == "" {
+		shadowStats.Add(p.Name+".allowed", 1)
+		return release
+	}
+
+	shadowStats.Add(p.Name+".rejected", 1)
+	rl.l.Info("shadow policy would reject request",
+		slog.String("policy", p.Name),
+		slog.String("key", key),
+		slog.String("reason", reason),
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.Int("cost", cost),
+	)
+
+	return release
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type AccessStorager interface {
+	ListEntries(ctx context.Context) ([]model.AccessEntry, error)
+	AddEntry(ctx context.Context, e model.AccessEntry) (model.AccessEntry, error)
+	DeleteEntry(ctx context.Context, id int64) error
+}
+
+type AccessService struct {
+	storage AccessStorager
+}
+
+func NewAccessService(storage AccessStorager) *AccessService {
+	return &AccessService{storage: storage}
+}
+
+func (s *AccessService) ListEntries() ([]model.AccessEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.ListEntries(ctx)
+}
+
+func (s *AccessService) AddEntry(e model.AccessEntry) (model.AccessEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.AddEntry(ctx, e)
+}
+
+func (s *AccessService) DeleteEntry(id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.DeleteEntry(ctx, id)
+}
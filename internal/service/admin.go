@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type AdminStorager interface {
+	GetAdminToken(ctx context.Context, hash string) (model.AdminToken, error)
+	ListAdminTokens(ctx context.Context) ([]model.AdminToken, error)
+	AddAdminToken(ctx context.Context, actor string, t model.AdminToken, hash string) (model.AdminToken, error)
+	DeleteAdminToken(ctx context.Context, actor string, id int64) error
+	ListAudit(ctx context.Context, targets []string, limit uint64) ([]model.AuditEntry, error)
+}
+
+type AdminService struct {
+	storage AdminStorager
+}
+
+func NewAdminService(storage AdminStorager) *AdminService {
+	return &AdminService{storage: storage}
+}
+
+func (s *AdminService) GetAdminToken(hash string) (model.AdminToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetAdminToken(ctx, hash)
+}
+
+func (s *AdminService) ListAdminTokens() ([]model.AdminToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.ListAdminTokens(ctx)
+}
+
+func (s *AdminService) AddAdminToken(actor string, t model.AdminToken, hash string) (model.AdminToken, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.AddAdminToken(ctx, actor, t, hash)
+}
+
+func (s *AdminService) DeleteAdminToken(actor string, id int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.DeleteAdminToken(ctx, actor, id)
+}
+
+func (s *AdminService) ListAudit(targets []string, limit uint64) ([]model.AuditEntry, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.ListAudit(ctx, targets, limit)
+}
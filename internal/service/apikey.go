@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+func (s *TokenService) CreateKey(actor, hash string, k model.APIKey) (model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.CreateKey(ctx, actor, hash, k)
+}
+
+func (s *TokenService) GetKey(prefix string) (model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetKey(ctx, prefix)
+}
+
+func (s *TokenService) GetKeyByHash(hash string) (model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetKeyByHash(ctx, hash)
+}
+
+func (s *TokenService) RotateKey(actor, prefix, hash string, k model.APIKey, overlap time.Duration) (model.APIKey, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.RotateKey(ctx, actor, prefix, hash, k, overlap)
+}
+
+func (s *TokenService) RevokeKey(actor, prefix string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.RevokeKey(ctx, actor, prefix)
+}
@@ -0,0 +1,26 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+// bulkTimeout bounds import and export which process the whole table at once
+const bulkTimeout = 5 * time.Minute
+
+func (s *TokenService) ImportCapacities(actor string, rows []model.TokenRow) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+	defer cancel()
+
+	return s.storage.ImportCapacities(ctx, actor, rows)
+}
+
+// ExportTokens calls fn for every stored token, export stops at the first error of fn
+func (s *TokenService) ExportTokens(fn func(model.TokenRecord) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), bulkTimeout)
+	defer cancel()
+
+	return s.storage.ExportTokens(ctx, fn)
+}
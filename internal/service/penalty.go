@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type PenaltyStorager interface {
+	ListBans(ctx context.Context, since time.Time) ([]model.Ban, error)
+	SaveBan(ctx context.Context, b model.Ban) error
+	DeleteBan(ctx context.Context, token string) error
+}
+
+type PenaltyService struct {
+	storage PenaltyStorager
+}
+
+func NewPenaltyService(storage PenaltyStorager) *PenaltyService {
+	return &PenaltyService{storage: storage}
+}
+
+func (s *PenaltyService) ListBans(since time.Time) ([]model.Ban, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.ListBans(ctx, since)
+}
+
+func (s *PenaltyService) SaveBan(b model.Ban) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.SaveBan(ctx, b)
+}
+
+func (s *PenaltyService) DeleteBan(token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.DeleteBan(ctx, token)
+}
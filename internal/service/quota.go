@@ -0,0 +1,51 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type QuotaStorager interface {
+	GetQuota(ctx context.Context, token string) (model.Quota, error)
+	SetQuota(ctx context.Context, actor, token string, q model.Quota) error
+	GetUsage(ctx context.Context, token string, day, month time.Time) (int64, int64, error)
+	AddUsage(ctx context.Context, deltas []model.QuotaUsage) ([]model.QuotaUsage, error)
+}
+
+type QuotaService struct {
+	storage QuotaStorager
+}
+
+func NewQuotaService(storage QuotaStorager) *QuotaService {
+	return &QuotaService{storage: storage}
+}
+
+func (s *QuotaService) GetQuota(token string) (model.Quota, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetQuota(ctx, token)
+}
+
+func (s *QuotaService) SetQuota(actor, token string, q model.Quota) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.SetQuota(ctx, actor, token, q)
+}
+
+func (s *QuotaService) GetUsage(token string, day, month time.Time) (int64, int64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetUsage(ctx, token, day, month)
+}
+
+func (s *QuotaService) AddUsage(deltas []model.QuotaUsage) ([]model.QuotaUsage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.AddUsage(ctx, deltas)
+}
@@ -3,31 +3,155 @@ package service
 import (
 	"context"
 	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
 )
 
 type TokenStorager interface {
-	GetCapacity(ctx context.Context, token string) (int, error)
-	SetCapacity(ctx context.Context, token string, capacity int) error
+	SetCapacity(ctx context.Context, actor, token string, capacity int) error
+	GetLimits(ctx context.Context, token string) (model.TokenLimits, error)
+	SetTenantCapacity(ctx context.Context, actor, tenant string, capacity int) error
+	SetTokenTenant(ctx context.Context, actor, token, tenant string) error
+	GetMaxInFlight(ctx context.Context, token string) (int, error)
+	SetMaxInFlight(ctx context.Context, actor, token string, limit *int) error
+	ListSchedules(ctx context.Context, token string) ([]model.Schedule, error)
+	AddSchedule(ctx context.Context, actor string, sch model.Schedule) (int64, error)
+	DeleteSchedule(ctx context.Context, actor string, id int64) error
+	CreateKey(ctx context.Context, actor, hash string, k model.APIKey) (model.APIKey, error)
+	GetKey(ctx context.Context, prefix string) (model.APIKey, error)
+	GetKeyByHash(ctx context.Context, hash string) (model.APIKey, error)
+	RotateKey(ctx context.Context, actor, prefix, hash string, k model.APIKey, overlap time.Duration) (model.APIKey, error)
+	RevokeKey(ctx context.Context, actor, prefix string) error
+	ListCapacityHistory(ctx context.Context, token string) ([]model.CapacityVersion, error)
+	RollbackCapacity(ctx context.Context, actor, token string, version int) (int, error)
+	ImportCapacities(ctx context.Context, actor string, rows []model.TokenRow) (int, error)
+	ExportTokens(ctx context.Context, fn func(model.TokenRecord) error) error
+	GetToken(ctx context.Context, token string) (model.TokenRecord, error)
+	ListTokens(ctx context.Context, after string, limit int) ([]model.TokenRecord, error)
+	DeleteToken(ctx context.Context, actor, token string) error
 }
 
 type TokenService struct {
-	storage TokenStorager
+	storage  TokenStorager
+	location *time.Location
+}
+
+// NewTokenService creates service, schedules are resolved in location
+func NewTokenService(storage TokenStorager, location *time.Location) *TokenService {
+	return &TokenService{storage: storage, location: location}
+}
+
+// GetLimits returns capacity of the most prioritized schedule active now or the base one
+// together with tenant of the token and its capacity, empty tenant means token has no one
+func (s *TokenService) GetLimits(token string) (int, string, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	limits, err := s.storage.GetLimits(ctx, token)
+	if err != nil {
+		return 0, "", 0, err
+	}
+
+	capacity := limits.Capacity
+	now := time.Now().In(s.location)
+	for _, sch := range limits.Schedules {
+		if sch.Active(now) {
+			capacity = sch.Capacity
+			break
+		}
+	}
+
+	return capacity, limits.Tenant, limits.TenantCapacity, nil
+}
+
+func (s *TokenService) SetCapacity(actor, token string, capacity int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.SetCapacity(ctx, actor, token, capacity)
+}
+
+func (s *TokenService) GetToken(token string) (model.TokenRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetToken(ctx, token)
+}
+
+func (s *TokenService) ListTokens(after string, limit int) ([]model.TokenRecord, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.ListTokens(ctx, after, limit)
+}
+
+func (s *TokenService) DeleteToken(actor, token string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.DeleteToken(ctx, actor, token)
 }
 
-func NewTokenService(storage TokenStorager) *TokenService {
-	return &TokenService{storage: storage}
+func (s *TokenService) ListCapacityHistory(token string) ([]model.CapacityVersion, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.ListCapacityHistory(ctx, token)
+}
+
+// RollbackCapacity sets capacity of token back to the one of version and returns it
+func (s *TokenService) RollbackCapacity(actor, token string, version int) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.RollbackCapacity(ctx, actor, token, version)
+}
+
+func (s *TokenService) SetTenantCapacity(actor, tenant string, capacity int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.SetTenantCapacity(ctx, actor, tenant, capacity)
+}
+
+func (s *TokenService) SetTokenTenant(actor, token, tenant string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.SetTokenTenant(ctx, actor, token, tenant)
+}
+
+func (s *TokenService) GetMaxInFlight(token string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetMaxInFlight(ctx, token)
+}
+
+func (s *TokenService) SetMaxInFlight(actor, token string, limit *int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.SetMaxInFlight(ctx, actor, token, limit)
+}
+
+func (s *TokenService) ListSchedules(token string) ([]model.Schedule, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.ListSchedules(ctx, token)
 }
 
-func (s *TokenService) GetCapacity(token string) (int, error) {
+func (s *TokenService) AddSchedule(actor string, sch model.Schedule) (int64, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return s.storage.GetCapacity(ctx, token)
+	return s.storage.AddSchedule(ctx, actor, sch)
 }
 
-func (s *TokenService) SetCapacity(token string, capacity int) error {
+func (s *TokenService) DeleteSchedule(actor string, id int64) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	return s.storage.SetCapacity(ctx, token, capacity)
+	return s.storage.DeleteSchedule(ctx, actor, id)
 }
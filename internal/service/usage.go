@@ -0,0 +1,37 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+type UsageStorager interface {
+	AddUsage(ctx context.Context, usage []model.Usage) error
+	GetUsage(ctx context.Context, token string, from, to time.Time, granularity, timezone string) ([]model.Usage, error)
+}
+
+type UsageService struct {
+	storage  UsageStorager
+	location *time.Location
+}
+
+// NewUsageService creates service, usage is aggregated by days and months in location
+func NewUsageService(storage UsageStorager, location *time.Location) *UsageService {
+	return &UsageService{storage: storage, location: location}
+}
+
+func (s *UsageService) AddUsage(usage []model.Usage) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.AddUsage(ctx, usage)
+}
+
+func (s *UsageService) GetUsage(token string, from, to time.Time, granularity string) ([]model.Usage, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return s.storage.GetUsage(ctx, token, from, to, granularity, s.location.String())
+}
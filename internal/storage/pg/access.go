@@ -0,0 +1,99 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AccessStorage struct {
+	pool *pgxpool.Pool
+	sb   squirrel.StatementBuilderType
+}
+
+func NewAccessStorage(pool *pgxpool.Pool) *AccessStorage {
+	return &AccessStorage{
+		pool: pool,
+		sb:   squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// ListEntries returns entries which are not expired yet
+func (s *AccessStorage) ListEntries(ctx context.Context) ([]model.AccessEntry, error) {
+	query, args, err := s.sb.
+		Select("id", "list", "entry", "reason", "expires_at", "created_at").
+		From("access_lists").
+		Where(squirrel.Or{
+			squirrel.Eq{"expires_at": nil},
+			squirrel.Expr("expires_at > NOW()"),
+		}).
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access entries: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.AccessEntry
+	for rows.Next() {
+		var e model.AccessEntry
+		if err := rows.Scan(&e.ID, &e.List, &e.Entry, &e.Reason, &e.ExpiresAt, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan access entry: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list access entries: %w", err)
+	}
+
+	return entries, nil
+}
+
+// AddEntry inserts entry or updates reason and expiry of existing one
+func (s *AccessStorage) AddEntry(ctx context.Context, e model.AccessEntry) (model.AccessEntry, error) {
+	query, args, err := s.sb.
+		Insert("access_lists").
+		Columns("list", "entry", "reason", "expires_at").
+		Values(e.List, e.Entry, e.Reason, e.ExpiresAt).
+		Suffix("ON CONFLICT (list, entry) DO UPDATE SET reason = EXCLUDED.reason, expires_at = EXCLUDED.expires_at").
+		Suffix("RETURNING id, created_at").
+		ToSql()
+	if err != nil {
+		return e, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	err = s.pool.QueryRow(ctx, query, args...).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return e, fmt.Errorf("failed to add access entry: %w", err)
+	}
+
+	return e, nil
+}
+
+func (s *AccessStorage) DeleteEntry(ctx context.Context, id int64) error {
+	query, args, err := s.sb.
+		Delete("access_lists").
+		Where(squirrel.Eq{"id": id}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete access entry: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("access entry %w", model.ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,242 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type AdminStorage struct {
+	pool *pgxpool.Pool
+	sb   squirrel.StatementBuilderType
+}
+
+func NewAdminStorage(pool *pgxpool.Pool) *AdminStorage {
+	return &AdminStorage{
+		pool: pool,
+		sb:   squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+func (s *AdminStorage) GetAdminToken(ctx context.Context, hash string) (model.AdminToken, error) {
+	query, args, err := s.sb.
+		Select("id", "name", "scope", "created_at").
+		From("admin_tokens").
+		Where(squirrel.Eq{"token_hash": hash}).
+		ToSql()
+	if err != nil {
+		return model.AdminToken{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var t model.AdminToken
+	err = s.pool.QueryRow(ctx, query, args...).Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, fmt.Errorf("admin token %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to get admin token: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *AdminStorage) ListAdminTokens(ctx context.Context) ([]model.AdminToken, error) {
+	query, args, err := s.sb.
+		Select("id", "name", "scope", "created_at").
+		From("admin_tokens").
+		OrderBy("id").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list admin tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []model.AdminToken
+	for rows.Next() {
+		var t model.AdminToken
+		if err := rows.Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan admin token: %w", err)
+		}
+		tokens = append(tokens, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list admin tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// AddAdminToken stores hash of the new token, name must be unique
+func (s *AdminStorage) AddAdminToken(ctx context.Context, actor string, t model.AdminToken, hash string) (model.AdminToken, error) {
+	query, args, err := s.sb.
+		Insert("admin_tokens").
+		Columns("name", "token_hash", "scope").
+		Values(t.Name, hash, t.Scope).
+		Suffix("RETURNING id, created_at").
+		ToSql()
+	if err != nil {
+		return t, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return t, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, query, args...).Scan(&t.ID, &t.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return t, fmt.Errorf("admin token %w", model.ErrConflict)
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to add admin token: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "add_admin_token", t.Name, nil, t); err != nil {
+		return t, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return t, fmt.Errorf("failed to commit admin token: %w", err)
+	}
+
+	return t, nil
+}
+
+func (s *AdminStorage) DeleteAdminToken(ctx context.Context, actor string, id int64) error {
+	query, args, err := s.sb.
+		Delete("admin_tokens").
+		Where(squirrel.Eq{"id": id}).
+		Suffix("RETURNING id, name, scope, created_at").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var t model.AdminToken
+	err = tx.QueryRow(ctx, query, args...).Scan(&t.ID, &t.Name, &t.Scope, &t.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("admin token %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete admin token: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "delete_admin_token", t.Name, t, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit admin token: %w", err)
+	}
+
+	return nil
+}
+
+// ListAudit returns the latest entries of any of targets first, no targets means entries of all targets
+func (s *AdminStorage) ListAudit(ctx context.Context, targets []string, limit uint64) ([]model.AuditEntry, error) {
+	sb := s.sb.
+		Select("id", "actor", "action", "target", "old_value", "new_value", "created_at").
+		From("audit_log").
+		OrderBy("id DESC").
+		Limit(limit)
+	if len(targets) > 0 {
+		sb = sb.Where(squirrel.Eq{"target": targets})
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []model.AuditEntry
+	for rows.Next() {
+		var e model.AuditEntry
+		var oldValue, newValue []byte
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &oldValue, &newValue, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		e.OldValue = jsonOrNull(oldValue)
+		e.NewValue = jsonOrNull(newValue)
+		entries = append(entries, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list audit log: %w", err)
+	}
+
+	return entries, nil
+}
+
+// writeAudit records change within transaction of the change itself, nil value is stored as null
+func writeAudit(ctx context.Context, tx pgx.Tx, sb squirrel.StatementBuilderType, actor, action, target string, oldValue, newValue any) error {
+	oldJSON, err := auditValue(oldValue)
+	if err != nil {
+		return err
+	}
+	newJSON, err := auditValue(newValue)
+	if err != nil {
+		return err
+	}
+
+	query, args, err := sb.
+		Insert("audit_log").
+		Columns("actor", "action", "target", "old_value", "new_value").
+		Values(actor, action, target, oldJSON, newJSON).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	return nil
+}
+
+func auditValue(v any) (*string, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode audit value: %w", err)
+	}
+
+	value := string(data)
+	return &value, nil
+}
+
+func jsonOrNull(data []byte) json.RawMessage {
+	if data == nil {
+		return json.RawMessage("null")
+	}
+
+	return data
+}
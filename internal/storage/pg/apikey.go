@@ -0,0 +1,246 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// CreateKey stores hash of the issued key with its prefix
+func (s *TokenStorage) CreateKey(ctx context.Context, actor, hash string, k model.APIKey) (model.APIKey, error) {
+	query, args, err := s.sb.
+		Insert("token_buckets").
+		Columns("token", "key_prefix", "capacity", "expires_at").
+		Values(hash, k.Prefix, k.Capacity, k.ExpiresAt).
+		Suffix("RETURNING created_at").
+		ToSql()
+	if err != nil {
+		return k, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return k, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, query, args...).Scan(&k.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return k, fmt.Errorf("key %w", model.ErrConflict)
+	}
+	if err != nil {
+		return k, fmt.Errorf("failed to create key: %w", err)
+	}
+
+	if err := writeHistory(ctx, tx, s.sb, actor, hash, nil, k.Capacity); err != nil {
+		return k, err
+	}
+	if err := writeAudit(ctx, tx, s.sb, actor, "create_key", hash, nil, k); err != nil {
+		return k, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return k, fmt.Errorf("failed to commit key: %w", err)
+	}
+
+	return k, nil
+}
+
+func (s *TokenStorage) GetKey(ctx context.Context, prefix string) (model.APIKey, error) {
+	return s.getKey(ctx, squirrel.Eq{"key_prefix": prefix})
+}
+
+// GetKeyByHash returns state of any stored token, tokens created before keys were issued have no prefix
+func (s *TokenStorage) GetKeyByHash(ctx context.Context, hash string) (model.APIKey, error) {
+	return s.getKey(ctx, squirrel.Eq{"token": hash})
+}
+
+func (s *TokenStorage) getKey(ctx context.Context, where squirrel.Eq) (model.APIKey, error) {
+	query, args, err := s.sb.
+		Select("COALESCE(key_prefix, '')", "capacity", "expires_at", "revoked_at", "created_at").
+		From("token_buckets").
+		Where(where).
+		ToSql()
+	if err != nil {
+		return model.APIKey{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var k model.APIKey
+	err = s.pool.QueryRow(ctx, query, args...).Scan(&k.Prefix, &k.Capacity, &k.ExpiresAt, &k.RevokedAt, &k.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return k, fmt.Errorf("key %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return k, fmt.Errorf("failed to get key: %w", err)
+	}
+
+	return k, nil
+}
+
+// RotateKey issues new key with settings and schedules of the old one, the old key keeps working for overlap.
+// Nil expiry of the new key means expiry of the old one
+func (s *TokenStorage) RotateKey(ctx context.Context, actor, prefix, hash string, k model.APIKey, overlap time.Duration) (model.APIKey, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return k, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldHash string
+	var old model.APIKey
+	found, err := lockRow(ctx, tx, s.sb.Select("token", "key_prefix", "expires_at", "revoked_at").From("token_buckets").Where(squirrel.Eq{"key_prefix": prefix}),
+		&oldHash, &old.Prefix, &old.ExpiresAt, &old.RevokedAt)
+	if err != nil {
+		return k, err
+	}
+	if !found {
+		return k, fmt.Errorf("key %w", model.ErrNotFound)
+	}
+
+	now := time.Now()
+	if err := old.Check(now); err != nil {
+		return k, err
+	}
+
+	if k.ExpiresAt == nil {
+		k.ExpiresAt = old.ExpiresAt
+	}
+
+	query, args, err := s.sb.
+		Insert("token_buckets").
+		Columns("token", "key_prefix", "capacity", "tenant", "max_in_flight", "daily_quota", "monthly_quota", "expires_at").
+		Select(s.sb.
+			Select().
+			Column("?::varchar", hash).
+			Column("?::varchar", k.Prefix).
+			Columns("capacity", "tenant", "max_in_flight", "daily_quota", "monthly_quota").
+			Column("?::timestamptz", k.ExpiresAt).
+			From("token_buckets").
+			Where(squirrel.Eq{"token": oldHash})).
+		Suffix("RETURNING capacity, created_at").
+		ToSql()
+	if err != nil {
+		return k, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, query, args...).Scan(&k.Capacity, &k.CreatedAt)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+		return k, fmt.Errorf("key %w", model.ErrConflict)
+	}
+	if err != nil {
+		return k, fmt.Errorf("failed to rotate key: %w", err)
+	}
+
+	query, args, err = s.sb.
+		Insert("capacity_schedules").
+		Columns("token", "capacity", "weekdays", "start_time", "end_time", "valid_from", "valid_until", "priority").
+		Select(s.sb.
+			Select().
+			Column("?::varchar", hash).
+			Columns("capacity", "weekdays", "start_time", "end_time", "valid_from", "valid_until", "priority").
+			From("capacity_schedules").
+			Where(squirrel.Eq{"token": oldHash})).
+		ToSql()
+	if err != nil {
+		return k, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return k, fmt.Errorf("failed to copy schedules: %w", err)
+	}
+
+	until := now.Add(overlap)
+	if old.ExpiresAt == nil || until.Before(*old.ExpiresAt) {
+		query, args, err = s.sb.
+			Update("token_buckets").
+			Set("expires_at", until).
+			Where(squirrel.Eq{"token": oldHash}).
+			ToSql()
+		if err != nil {
+			return k, fmt.Errorf("failed to build query: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return k, fmt.Errorf("failed to expire rotated key: %w", err)
+		}
+	}
+
+	prev := old
+	old.ExpiresAt = &until
+	if prev.ExpiresAt != nil && prev.ExpiresAt.Before(until) {
+		old.ExpiresAt = prev.ExpiresAt
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "rotate_key", oldHash, prev, old); err != nil {
+		return k, err
+	}
+	if err := writeHistory(ctx, tx, s.sb, actor, hash, nil, k.Capacity); err != nil {
+		return k, err
+	}
+	if err := writeAudit(ctx, tx, s.sb, actor, "create_key", hash, nil, k); err != nil {
+		return k, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return k, fmt.Errorf("failed to commit key: %w", err)
+	}
+
+	return k, nil
+}
+
+// RevokeKey stops key immediately, revoking revoked key does nothing
+func (s *TokenStorage) RevokeKey(ctx context.Context, actor, prefix string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var hash string
+	var old model.APIKey
+	found, err := lockRow(ctx, tx, s.sb.Select("token", "key_prefix", "expires_at", "revoked_at").From("token_buckets").Where(squirrel.Eq{"key_prefix": prefix}),
+		&hash, &old.Prefix, &old.ExpiresAt, &old.RevokedAt)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("key %w", model.ErrNotFound)
+	}
+	if old.RevokedAt != nil {
+		return nil
+	}
+
+	now := time.Now()
+	query, args, err := s.sb.
+		Update("token_buckets").
+		Set("revoked_at", now).
+		Where(squirrel.Eq{"token": hash}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to revoke key: %w", err)
+	}
+
+	revoked := old
+	revoked.RevokedAt = &now
+	if err := writeAudit(ctx, tx, s.sb, actor, "revoke_key", hash, old, revoked); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,136 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/jackc/pgx/v5"
+)
+
+// ImportCapacities sets capacities of hashed tokens in one transaction, unknown tokens are created.
+// Every change is written to capacity history and audit log. Rows must have unique token hashes
+func (s *TokenStorage) ImportCapacities(ctx context.Context, actor string, rows []model.TokenRow) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, "CREATE TEMPORARY TABLE capacity_import (token VARCHAR(255) PRIMARY KEY, capacity INTEGER NOT NULL) ON COMMIT DROP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create import table: %w", err)
+	}
+
+	copied, err := tx.CopyFrom(ctx, pgx.Identifier{"capacity_import"}, []string{"token", "capacity"},
+		pgx.CopyFromSlice(len(rows), func(i int) ([]any, error) {
+			return []any{rows[i].TokenHash, rows[i].Capacity}, nil
+		}))
+	if err != nil {
+		return 0, fmt.Errorf("failed to copy capacities: %w", err)
+	}
+
+	// old capacities must not change until history is written
+	_, err = tx.Exec(ctx, "SELECT b.token FROM token_buckets b JOIN capacity_import i ON i.token = b.token FOR UPDATE OF b")
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock imported tokens: %w", err)
+	}
+
+	// new tokens have no rows to lock, so history versions are serialized as in writeHistory, in order to avoid deadlocks
+	_, err = tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext(token)) FROM (SELECT token FROM capacity_import ORDER BY token) i")
+	if err != nil {
+		return 0, fmt.Errorf("failed to lock capacity history: %w", err)
+	}
+
+	query, args, err := s.sb.
+		Insert("token_bucket_history").
+		Columns("token", "version", "old_capacity", "new_capacity", "actor").
+		Select(s.sb.
+			Select("i.token").
+			Column("COALESCE((SELECT MAX(h.version) FROM token_bucket_history h WHERE h.token = i.token), 0) + 1").
+			Columns("b.capacity", "i.capacity").
+			Column("?::varchar", actor).
+			From("capacity_import i").
+			LeftJoin("token_buckets b ON b.token = i.token")).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to write capacity history: %w", err)
+	}
+
+	query, args, err = s.sb.
+		Insert("audit_log").
+		Columns("actor", "action", "target", "old_value", "new_value").
+		Select(s.sb.
+			Select().
+			Column("?::varchar", actor).
+			Column("'import_capacity'").
+			Column("i.token").
+			Column("CASE WHEN b.token IS NULL THEN NULL ELSE jsonb_build_object('capacity', b.capacity) END").
+			Column("jsonb_build_object('capacity', i.capacity)").
+			From("capacity_import i").
+			LeftJoin("token_buckets b ON b.token = i.token")).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to write audit log: %w", err)
+	}
+
+	query, args, err = s.sb.
+		Insert("token_buckets").
+		Columns("token", "capacity").
+		Select(s.sb.Select("token", "capacity").From("capacity_import")).
+		Suffix("ON CONFLICT (token) DO UPDATE SET capacity = EXCLUDED.capacity").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to import capacities: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit import: %w", err)
+	}
+
+	return int(copied), nil
+}
+
+// ExportTokens calls fn for every stored token without loading the whole table into memory,
+// export stops at the first error of fn
+func (s *TokenStorage) ExportTokens(ctx context.Context, fn func(model.TokenRecord) error) error {
+	query, args, err := s.sb.
+		Select(recordColumns...).
+		From("token_buckets").
+		OrderBy("token").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to export tokens: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		t, err := scanRecord(rows)
+		if err != nil {
+			return fmt.Errorf("failed to export tokens: %w", err)
+		}
+		if err := fn(t); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to export tokens: %w", err)
+	}
+
+	return nil
+}
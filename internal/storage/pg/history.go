@@ -0,0 +1,134 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+// ListCapacityHistory returns changes of token capacity, the latest version goes first
+func (s *TokenStorage) ListCapacityHistory(ctx context.Context, token string) ([]model.CapacityVersion, error) {
+	query, args, err := s.sb.
+		Select("version", "old_capacity", "new_capacity", "actor", "changed_at").
+		From("token_bucket_history").
+		Where(squirrel.Eq{"token": token}).
+		OrderBy("version DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list capacity history: %w", err)
+	}
+
+	history, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.CapacityVersion, error) {
+		var v model.CapacityVersion
+		err := row.Scan(&v.Version, &v.OldCapacity, &v.NewCapacity, &v.Actor, &v.ChangedAt)
+		return v, err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list capacity history: %w", err)
+	}
+
+	return history, nil
+}
+
+// RollbackCapacity sets token capacity to the one set by version, rollback is recorded as a new version.
+// Restored capacity is returned
+func (s *TokenStorage) RollbackCapacity(ctx context.Context, actor, token string, version int) (int, error) {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldCapacity int
+	found, err := lockRow(ctx, tx, s.sb.Select("capacity").From("token_buckets").Where(squirrel.Eq{"token": token}), &oldCapacity)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("token %w", model.ErrNotFound)
+	}
+
+	query, args, err := s.sb.
+		Select("new_capacity").
+		From("token_bucket_history").
+		Where(squirrel.Eq{"token": token, "version": version}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var capacity int
+	err = tx.QueryRow(ctx, query, args...).Scan(&capacity)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("version %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get version: %w", err)
+	}
+
+	query, args, err = s.sb.
+		Update("token_buckets").
+		Set("capacity", capacity).
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to roll capacity back: %w", err)
+	}
+
+	if err := writeHistory(ctx, tx, s.sb, actor, token, &oldCapacity, capacity); err != nil {
+		return 0, err
+	}
+	if err := writeAudit(ctx, tx, s.sb, actor, "rollback_capacity", token, capacityValue{Capacity: oldCapacity}, capacityValue{Capacity: capacity}); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit capacity: %w", err)
+	}
+
+	return capacity, nil
+}
+
+// writeHistory records capacity change as the next version of token. Token which is not stored yet has no row to lock,
+// so versions of token are serialized by advisory lock held until the end of tx
+func writeHistory(ctx context.Context, tx pgx.Tx, sb squirrel.StatementBuilderType, actor, token string, old *int, capacity int) error {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", token); err != nil {
+		return fmt.Errorf("failed to lock capacity history: %w", err)
+	}
+
+	query, args, err := sb.
+		Insert("token_bucket_history").
+		Columns("token", "version", "old_capacity", "new_capacity", "actor").
+		Select(sb.
+			Select().
+			Column("?::varchar", token).
+			Column("COALESCE(MAX(version), 0) + 1").
+			Column("?::integer", old).
+			Column("?::integer", capacity).
+			Column("?::varchar", actor).
+			From("token_bucket_history").
+			Where(squirrel.Eq{"token": token})).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to write capacity history: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type KeyHasher interface {
+	Hash(key string) string
+	// Fingerprint identifies secret of the hasher
+	Fingerprint() string
+}
+
+// keyTables store API keys in token column, capacity schedules follow token buckets by cascade
+var keyTables = []string{"token_buckets", "quota_usage", "token_usage", "penalties"}
+
+// keyActions are audit log actions which target is API key
+var keyActions = []string{"set_capacity", "set_token_tenant", "set_max_in_flight", "set_quota", "add_schedule", "delete_schedule"}
+
+// HashKeys replaces raw API keys stored before keys were hashed with their hashes, access lists included. It runs once per database,
+// later runs only check that keys were hashed with the same secret. Number of hashed keys is returned
+func HashKeys(ctx context.Context, pool *pgxpool.Pool, h KeyHasher) (int, error) {
+	sb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// instances started at once must not hash keys twice
+	if _, err := tx.Exec(ctx, "LOCK TABLE key_hash_state IN EXCLUSIVE MODE"); err != nil {
+		return 0, fmt.Errorf("failed to lock key hash state: %w", err)
+	}
+
+	var fingerprint string
+	var accessHashed bool
+	err = tx.QueryRow(ctx, "SELECT fingerprint, access_hashed FROM key_hash_state").Scan(&fingerprint, &accessHashed)
+	if err == nil {
+		if fingerprint != h.Fingerprint() {
+			return 0, errors.New("key hash secret differs from the one stored keys were hashed with")
+		}
+		if accessHashed {
+			return 0, nil
+		}
+
+		// access lists were not hashed by databases migrated before they were
+		n, err := hashAccessEntries(ctx, tx, sb, h)
+		if err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(ctx, "UPDATE key_hash_state SET access_hashed = TRUE"); err != nil {
+			return 0, fmt.Errorf("failed to save key hash state: %w", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return 0, fmt.Errorf("failed to commit key hashes: %w", err)
+		}
+
+		return n, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return 0, fmt.Errorf("failed to get key hash state: %w", err)
+	}
+
+	union := ""
+	for i, table := range keyTables {
+		if i > 0 {
+			union += " UNION "
+		}
+		union += "SELECT token FROM " + table
+	}
+
+	rows, err := tx.Query(ctx, union)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored keys: %w", err)
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return 0, fmt.Errorf("failed to list stored keys: %w", err)
+	}
+
+	hashes := make([][]any, 0, len(keys))
+	for _, key := range keys {
+		hashes = append(hashes, []any{key, h.Hash(key)})
+	}
+
+	_, err = tx.Exec(ctx, "CREATE TEMPORARY TABLE key_hashes (raw VARCHAR(255) PRIMARY KEY, hashed CHAR(64) NOT NULL) ON COMMIT DROP")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create key hashes table: %w", err)
+	}
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{"key_hashes"}, []string{"raw", "hashed"}, pgx.CopyFromRows(hashes)); err != nil {
+		return 0, fmt.Errorf("failed to copy key hashes: %w", err)
+	}
+
+	for _, table := range keyTables {
+		query, args, err := sb.
+			Update(table).
+			Set("token", squirrel.Expr("k.hashed")).
+			From("key_hashes k").
+			Where(table + ".token = k.raw").
+			ToSql()
+		if err != nil {
+			return 0, fmt.Errorf("failed to build query: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return 0, fmt.Errorf("failed to hash keys of %s: %w", table, err)
+		}
+	}
+
+	// schedules in audit log hold key as well
+	query, args, err := sb.
+		Update("audit_log").
+		Set("target", squirrel.Expr("k.hashed")).
+		Set("old_value", squirrel.Expr("CASE WHEN audit_log.old_value ?? 'token' THEN jsonb_set(audit_log.old_value, '{token}', to_jsonb(k.hashed)) ELSE audit_log.old_value END")).
+		Set("new_value", squirrel.Expr("CASE WHEN audit_log.new_value ?? 'token' THEN jsonb_set(audit_log.new_value, '{token}', to_jsonb(k.hashed)) ELSE audit_log.new_value END")).
+		From("key_hashes k").
+		Where("audit_log.target = k.raw").
+		Where(squirrel.Eq{"audit_log.action": keyActions}).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to hash keys of audit log: %w", err)
+	}
+
+	n, err := hashAccessEntries(ctx, tx, sb, h)
+	if err != nil {
+		return 0, err
+	}
+
+	query, args, err = sb.
+		Insert("key_hash_state").
+		Columns("fingerprint", "access_hashed").
+		Values(h.Fingerprint(), true).
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return 0, fmt.Errorf("failed to save key hash state: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit key hashes: %w", err)
+	}
+
+	return len(keys) + n, nil
+}
+
+// hashAccessEntries replaces API keys of allow and deny lists with their hashes, IPs are stored as CIDRs
+func hashAccessEntries(ctx context.Context, tx pgx.Tx, sb squirrel.StatementBuilderType, h KeyHasher) (int, error) {
+	rows, err := tx.Query(ctx, "SELECT id, entry FROM access_lists WHERE entry NOT LIKE '%/%'")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list access entries: %w", err)
+	}
+
+	type accessKey struct {
+		ID    int64
+		Entry string
+	}
+	keys, err := pgx.CollectRows(rows, pgx.RowToStructByPos[accessKey])
+	if err != nil {
+		return 0, fmt.Errorf("failed to list access entries: %w", err)
+	}
+
+	for _, k := range keys {
+		query, args, err := sb.
+			Update("access_lists").
+			Set("entry", h.Hash(k.Entry)).
+			Where(squirrel.Eq{"id": k.ID}).
+			ToSql()
+		if err != nil {
+			return 0, fmt.Errorf("failed to build query: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return 0, fmt.Errorf("failed to hash access entry: %w", err)
+		}
+	}
+
+	return len(keys), nil
+}
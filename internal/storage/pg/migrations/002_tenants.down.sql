@@ -0,0 +1,3 @@
+ALTER TABLE token_buckets DROP COLUMN IF EXISTS tenant;
+
+DROP TABLE IF EXISTS tenants;
\ No newline at end of file
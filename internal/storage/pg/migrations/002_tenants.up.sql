@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS tenants (
+    tenant VARCHAR(255) PRIMARY KEY,
+    capacity INTEGER NOT NULL
+);
+
+ALTER TABLE token_buckets ADD COLUMN IF NOT EXISTS tenant VARCHAR(255) REFERENCES tenants (tenant) ON DELETE SET NULL;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE token_buckets DROP COLUMN IF EXISTS max_in_flight;
\ No newline at end of file
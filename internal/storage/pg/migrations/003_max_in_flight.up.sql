@@ -0,0 +1 @@
+ALTER TABLE token_buckets ADD COLUMN IF NOT EXISTS max_in_flight INTEGER;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS access_lists;
\ No newline at end of file
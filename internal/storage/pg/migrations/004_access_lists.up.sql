@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS access_lists (
+    id SERIAL PRIMARY KEY,
+    list VARCHAR(16) NOT NULL CHECK (list IN ('allow', 'deny')),
+    entry VARCHAR(255) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (list, entry)
+);
\ No newline at end of file
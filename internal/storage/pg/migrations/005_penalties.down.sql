@@ -0,0 +1 @@
+DROP TABLE IF EXISTS penalties;
\ No newline at end of file
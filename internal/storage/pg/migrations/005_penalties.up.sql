@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS penalties (
+    token VARCHAR(255) PRIMARY KEY,
+    strikes INTEGER NOT NULL,
+    banned_until TIMESTAMPTZ NOT NULL
+);
\ No newline at end of file
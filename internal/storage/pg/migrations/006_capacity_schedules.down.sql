@@ -0,0 +1 @@
+DROP TABLE IF EXISTS capacity_schedules;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS capacity_schedules (
+    id SERIAL PRIMARY KEY,
+    token VARCHAR(255) NOT NULL REFERENCES token_buckets (token) ON DELETE CASCADE ON UPDATE CASCADE,
+    capacity INTEGER NOT NULL,
+    weekdays SMALLINT NOT NULL DEFAULT 127,
+    start_time TIME NOT NULL DEFAULT '00:00',
+    end_time TIME NOT NULL DEFAULT '24:00',
+    valid_from TIMESTAMPTZ,
+    valid_until TIMESTAMPTZ,
+    priority INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE INDEX IF NOT EXISTS capacity_schedules_token_idx ON capacity_schedules (token);
\ No newline at end of file
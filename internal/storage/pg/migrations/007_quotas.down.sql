@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS quota_usage;
+
+ALTER TABLE token_buckets
+    DROP COLUMN IF EXISTS daily_quota,
+    DROP COLUMN IF EXISTS monthly_quota;
\ No newline at end of file
@@ -0,0 +1,11 @@
+ALTER TABLE token_buckets
+    ADD COLUMN IF NOT EXISTS daily_quota BIGINT,
+    ADD COLUMN IF NOT EXISTS monthly_quota BIGINT;
+
+CREATE TABLE IF NOT EXISTS quota_usage (
+    token VARCHAR(255) NOT NULL,
+    period VARCHAR(8) NOT NULL CHECK (period IN ('day', 'month')),
+    period_start DATE NOT NULL,
+    used BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (token, period, period_start)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS token_usage;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS token_usage (
+    token VARCHAR(255) NOT NULL,
+    bucket_start TIMESTAMPTZ NOT NULL,
+    allowed BIGINT NOT NULL DEFAULT 0,
+    rejected BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (token, bucket_start)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS key_hash_state;
\ No newline at end of file
@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS key_hash_state (
+    id BOOLEAN PRIMARY KEY DEFAULT TRUE CHECK (id),
+    fingerprint CHAR(64) NOT NULL,
+    hashed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
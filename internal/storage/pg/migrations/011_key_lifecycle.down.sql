@@ -0,0 +1,5 @@
+ALTER TABLE token_buckets
+    DROP COLUMN IF EXISTS key_prefix,
+    DROP COLUMN IF EXISTS expires_at,
+    DROP COLUMN IF EXISTS revoked_at,
+    DROP COLUMN IF EXISTS created_at;
\ No newline at end of file
@@ -0,0 +1,5 @@
+ALTER TABLE token_buckets
+    ADD COLUMN IF NOT EXISTS key_prefix VARCHAR(32) UNIQUE,
+    ADD COLUMN IF NOT EXISTS expires_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS revoked_at TIMESTAMPTZ,
+    ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS token_bucket_history;
\ No newline at end of file
@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS token_bucket_history (
+    id BIGSERIAL PRIMARY KEY,
+    token VARCHAR(255) NOT NULL,
+    version INTEGER NOT NULL,
+    old_capacity INTEGER,
+    new_capacity INTEGER NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    UNIQUE (token, version)
+);
\ No newline at end of file
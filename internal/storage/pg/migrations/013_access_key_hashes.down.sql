@@ -0,0 +1 @@
+ALTER TABLE key_hash_state DROP COLUMN IF EXISTS access_hashed;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE key_hash_state ADD COLUMN IF NOT EXISTS access_hashed BOOLEAN NOT NULL DEFAULT FALSE;
\ No newline at end of file
@@ -0,0 +1,95 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type PenaltyStorage struct {
+	pool *pgxpool.Pool
+	sb   squirrel.StatementBuilderType
+}
+
+func NewPenaltyStorage(pool *pgxpool.Pool) *PenaltyStorage {
+	return &PenaltyStorage{
+		pool: pool,
+		sb:   squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// ListBans returns bans which end after since
+func (s *PenaltyStorage) ListBans(ctx context.Context, since time.Time) ([]model.Ban, error) {
+	query, args, err := s.sb.
+		Select("token", "strikes", "banned_until").
+		From("penalties").
+		Where(squirrel.Gt{"banned_until": since}).
+		OrderBy("banned_until").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bans: %w", err)
+	}
+	defer rows.Close()
+
+	var bans []model.Ban
+	for rows.Next() {
+		var b model.Ban
+		if err := rows.Scan(&b.Token, &b.Strikes, &b.BannedUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan ban: %w", err)
+		}
+		bans = append(bans, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list bans: %w", err)
+	}
+
+	return bans, nil
+}
+
+func (s *PenaltyStorage) SaveBan(ctx context.Context, b model.Ban) error {
+	query, args, err := s.sb.
+		Insert("penalties").
+		Columns("token", "strikes", "banned_until").
+		Values(b.Token, b.Strikes, b.BannedUntil).
+		Suffix("ON CONFLICT (token) DO UPDATE SET strikes = EXCLUDED.strikes, banned_until = EXCLUDED.banned_until").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to save ban: %w", err)
+	}
+
+	return nil
+}
+
+func (s *PenaltyStorage) DeleteBan(ctx context.Context, token string) error {
+	query, args, err := s.sb.
+		Delete("penalties").
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tag, err := s.pool.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to delete ban: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("ban %w", model.ErrNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,175 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type QuotaStorage struct {
+	pool *pgxpool.Pool
+	sb   squirrel.StatementBuilderType
+}
+
+func NewQuotaStorage(pool *pgxpool.Pool) *QuotaStorage {
+	return &QuotaStorage{
+		pool: pool,
+		sb:   squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+func (s *QuotaStorage) GetQuota(ctx context.Context, token string) (model.Quota, error) {
+	query, args, err := s.sb.
+		Select("daily_quota", "monthly_quota").
+		From("token_buckets").
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return model.Quota{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	var q model.Quota
+	err = s.pool.QueryRow(ctx, query, args...).Scan(&q.Daily, &q.Monthly)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return q, fmt.Errorf("token %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return q, fmt.Errorf("failed to get quota: %w", err)
+	}
+
+	return q, nil
+}
+
+func (s *QuotaStorage) SetQuota(ctx context.Context, actor, token string, q model.Quota) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var old model.Quota
+	found, err := lockRow(ctx, tx, s.sb.Select("daily_quota", "monthly_quota").From("token_buckets").Where(squirrel.Eq{"token": token}), &old.Daily, &old.Monthly)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("token %w", model.ErrNotFound)
+	}
+
+	query, args, err := s.sb.
+		Update("token_buckets").
+		Set("daily_quota", q.Daily).
+		Set("monthly_quota", q.Monthly).
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to set quota: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "set_quota", token, old, q); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit quota: %w", err)
+	}
+
+	return nil
+}
+
+// GetUsage returns usage of token in the day and the month starting at given dates
+func (s *QuotaStorage) GetUsage(ctx context.Context, token string, day, month time.Time) (int64, int64, error) {
+	query, args, err := s.sb.
+		Select("period", "used").
+		From("quota_usage").
+		Where(squirrel.Eq{"token": token}).
+		Where(squirrel.Or{
+			squirrel.Eq{"period": model.PeriodDay, "period_start": day},
+			squirrel.Eq{"period": model.PeriodMonth, "period_start": month},
+		}).
+		ToSql()
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to get usage: %w", err)
+	}
+	defer rows.Close()
+
+	var daily, monthly int64
+	for rows.Next() {
+		var period string
+		var used int64
+		if err := rows.Scan(&period, &used); err != nil {
+			return 0, 0, fmt.Errorf("failed to scan usage: %w", err)
+		}
+
+		if period == model.PeriodDay {
+			daily = used
+		} else {
+			monthly = used
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return 0, 0, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	return daily, monthly, nil
+}
+
+// AddUsage adds deltas to stored usage in a single batch and returns the resulting totals
+func (s *QuotaStorage) AddUsage(ctx context.Context, deltas []model.QuotaUsage) ([]model.QuotaUsage, error) {
+	batch := &pgx.Batch{}
+	for _, d := range deltas {
+		query, args, err := s.sb.
+			Insert("quota_usage").
+			Columns("token", "period", "period_start", "used").
+			Values(d.Token, d.Period, d.PeriodStart, d.Used).
+			Suffix("ON CONFLICT (token, period, period_start) DO UPDATE SET used = quota_usage.used + EXCLUDED.used").
+			Suffix("RETURNING used").
+			ToSql()
+		if err != nil {
+			return nil, fmt.Errorf("failed to build query: %w", err)
+		}
+		batch.Queue(query, args...)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	results := tx.SendBatch(ctx, batch)
+	totals := make([]model.QuotaUsage, len(deltas))
+	for i, d := range deltas {
+		d.Used = 0
+		if err := results.QueryRow().Scan(&d.Used); err != nil {
+			results.Close()
+			return nil, fmt.Errorf("failed to add usage: %w", err)
+		}
+		totals[i] = d
+	}
+	if err := results.Close(); err != nil {
+		return nil, fmt.Errorf("failed to add usage: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit usage: %w", err)
+	}
+
+	return totals, nil
+}
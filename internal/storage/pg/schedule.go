@@ -0,0 +1,148 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ListSchedules returns schedules of token, the most prioritized first
+func (s *TokenStorage) ListSchedules(ctx context.Context, token string) ([]model.Schedule, error) {
+	query, args, err := s.sb.
+		Select("id", "token", "capacity", "weekdays", "to_char(start_time, 'HH24:MI')", "to_char(end_time, 'HH24:MI')",
+			"valid_from", "valid_until", "priority").
+		From("capacity_schedules").
+		Where(squirrel.Eq{"token": token}).
+		OrderBy("priority DESC", "id DESC").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+	defer rows.Close()
+
+	var schedules []model.Schedule
+	for rows.Next() {
+		var sch model.Schedule
+		var weekdays int16
+		err := rows.Scan(&sch.ID, &sch.Token, &sch.Capacity, &weekdays, &sch.Start, &sch.End,
+			&sch.ValidFrom, &sch.ValidUntil, &sch.Priority)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan schedule: %w", err)
+		}
+
+		sch.Weekdays = weekdaysOf(weekdays)
+		schedules = append(schedules, sch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list schedules: %w", err)
+	}
+
+	return schedules, nil
+}
+
+// weekdaysOf unpacks bit mask of weekdays, bit of Sunday is the lowest
+func weekdaysOf(mask int16) []time.Weekday {
+	var weekdays []time.Weekday
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		if mask&(1<<d) != 0 {
+			weekdays = append(weekdays, d)
+		}
+	}
+
+	return weekdays
+}
+
+func (s *TokenStorage) AddSchedule(ctx context.Context, actor string, sch model.Schedule) (int64, error) {
+	var weekdays int16
+	for _, d := range sch.Weekdays {
+		weekdays |= 1 << d
+	}
+	if weekdays == 0 {
+		weekdays = 1<<7 - 1
+	}
+
+	query, args, err := s.sb.
+		Insert("capacity_schedules").
+		Columns("token", "capacity", "weekdays", "start_time", "end_time", "valid_from", "valid_until", "priority").
+		Values(sch.Token, sch.Capacity, weekdays,
+			squirrel.Expr("?::text::time", sch.Start), squirrel.Expr("?::text::time", sch.End),
+			sch.ValidFrom, sch.ValidUntil, sch.Priority).
+		Suffix("RETURNING id").
+		ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, query, args...).Scan(&sch.ID)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23503" {
+		return 0, fmt.Errorf("token %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to add schedule: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "add_schedule", sch.Token, nil, sch); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, fmt.Errorf("failed to commit schedule: %w", err)
+	}
+
+	return sch.ID, nil
+}
+
+func (s *TokenStorage) DeleteSchedule(ctx context.Context, actor string, id int64) error {
+	query, args, err := s.sb.
+		Delete("capacity_schedules").
+		Where(squirrel.Eq{"id": id}).
+		Suffix("RETURNING id, token, capacity, to_char(start_time, 'HH24:MI'), to_char(end_time, 'HH24:MI'), valid_from, valid_until, priority").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var sch model.Schedule
+	err = tx.QueryRow(ctx, query, args...).Scan(&sch.ID, &sch.Token, &sch.Capacity, &sch.Start, &sch.End,
+		&sch.ValidFrom, &sch.ValidUntil, &sch.Priority)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("schedule %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete schedule: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "delete_schedule", sch.Token, sch, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit schedule: %w", err)
+	}
+
+	return nil
+}
@@ -2,12 +2,16 @@ package pg
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
+	"github.com/Arzeeq/cloud-camp/internal/model"
 	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// TokenStorage stores and looks tokens up by their keyed hashes, raw keys never reach it
 type TokenStorage struct {
 	pool *pgxpool.Pool
 	sb   squirrel.StatementBuilderType
@@ -20,9 +24,211 @@ func NewTokenStorage(pool *pgxpool.Pool) *TokenStorage {
 	}
 }
 
-func (s *TokenStorage) GetCapacity(ctx context.Context, token string) (int, error) {
+type capacityValue struct {
+	Capacity int `json:"capacity"`
+}
+
+func (s *TokenStorage) SetCapacity(ctx context.Context, actor, token string, capacity int) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var old any
+	var oldCapacity *int
+	found, err := lockRow(ctx, tx, s.sb.Select("capacity").From("token_buckets").Where(squirrel.Eq{"token": token}), &oldCapacity)
+	if err != nil {
+		return err
+	}
+	if found {
+		old = capacityValue{Capacity: *oldCapacity}
+	}
+
+	query, args, err := s.sb.
+		Insert("token_buckets").
+		Columns("token", "capacity").
+		Values(token, capacity).
+		Suffix("ON CONFLICT (token) DO UPDATE SET capacity = EXCLUDED.capacity").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to set capacity: %w", err)
+	}
+
+	if err := writeHistory(ctx, tx, s.sb, actor, token, oldCapacity, capacity); err != nil {
+		return err
+	}
+	if err := writeAudit(ctx, tx, s.sb, actor, "set_capacity", token, old, capacityValue{Capacity: capacity}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit capacity: %w", err)
+	}
+
+	return nil
+}
+
+// GetLimits returns capacity, tenant and schedules of the token in one query, it is run on every refill
+func (s *TokenStorage) GetLimits(ctx context.Context, token string) (model.TokenLimits, error) {
+	query, args, err := s.sb.
+		Select("b.capacity", "COALESCE(t.tenant, '')", "COALESCE(t.capacity, 0)",
+			"s.id", "s.capacity", "s.weekdays", "to_char(s.start_time, 'HH24:MI')", "to_char(s.end_time, 'HH24:MI')",
+			"s.valid_from", "s.valid_until", "s.priority").
+		From("token_buckets b").
+		LeftJoin("tenants t ON t.tenant = b.tenant").
+		LeftJoin("capacity_schedules s ON s.token = b.token").
+		Where(squirrel.Eq{"b.token": token}).
+		OrderBy("s.priority DESC", "s.id DESC").
+		ToSql()
+	if err != nil {
+		return model.TokenLimits{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return model.TokenLimits{}, fmt.Errorf("failed to get limits: %w", err)
+	}
+	defer rows.Close()
+
+	var limits model.TokenLimits
+	found := false
+	for rows.Next() {
+		found = true
+
+		// schedule columns are null when token has no schedules
+		var id *int64
+		var capacity, priority *int
+		var weekdays *int16
+		var start, end *string
+		var sch model.Schedule
+		err := rows.Scan(&limits.Capacity, &limits.Tenant, &limits.TenantCapacity,
+			&id, &capacity, &weekdays, &start, &end, &sch.ValidFrom, &sch.ValidUntil, &priority)
+		if err != nil {
+			return model.TokenLimits{}, fmt.Errorf("failed to scan limits: %w", err)
+		}
+		if id == nil {
+			continue
+		}
+
+		sch.ID, sch.Token, sch.Capacity, sch.Priority = *id, token, *capacity, *priority
+		sch.Weekdays = weekdaysOf(*weekdays)
+		sch.Start, sch.End = *start, *end
+		limits.Schedules = append(limits.Schedules, sch)
+	}
+	if err := rows.Err(); err != nil {
+		return model.TokenLimits{}, fmt.Errorf("failed to get limits: %w", err)
+	}
+	if !found {
+		return model.TokenLimits{}, model.ErrNotFound
+	}
+
+	return limits, nil
+}
+
+func (s *TokenStorage) SetTenantCapacity(ctx context.Context, actor, tenant string, capacity int) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var old any
+	var oldCapacity int
+	found, err := lockRow(ctx, tx, s.sb.Select("capacity").From("tenants").Where(squirrel.Eq{"tenant": tenant}), &oldCapacity)
+	if err != nil {
+		return err
+	}
+	if found {
+		old = capacityValue{Capacity: oldCapacity}
+	}
+
 	query, args, err := s.sb.
-		Select("capacity").
+		Insert("tenants").
+		Columns("tenant", "capacity").
+		Values(tenant, capacity).
+		Suffix("ON CONFLICT (tenant) DO UPDATE SET capacity = EXCLUDED.capacity").
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to set tenant capacity: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "set_tenant_capacity", tenant, old, capacityValue{Capacity: capacity}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit tenant capacity: %w", err)
+	}
+
+	return nil
+}
+
+type tenantValue struct {
+	Tenant *string `json:"tenant"`
+}
+
+// SetTokenTenant attaches token to tenant, empty tenant detaches it
+func (s *TokenStorage) SetTokenTenant(ctx context.Context, actor, token, tenant string) error {
+	var value *string
+	if tenant != "" {
+		value = &tenant
+	}
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var old tenantValue
+	found, err := lockRow(ctx, tx, s.sb.Select("tenant").From("token_buckets").Where(squirrel.Eq{"token": token}), &old.Tenant)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("token %w", model.ErrNotFound)
+	}
+
+	query, args, err := s.sb.
+		Update("token_buckets").
+		Set("tenant", value).
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to set token tenant: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "set_token_tenant", token, old, tenantValue{Tenant: value}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit token tenant: %w", err)
+	}
+
+	return nil
+}
+
+// GetMaxInFlight fails when token is unknown or has no own limit
+func (s *TokenStorage) GetMaxInFlight(ctx context.Context, token string) (int, error) {
+	query, args, err := s.sb.
+		Select("max_in_flight").
 		From("token_buckets").
 		Where(squirrel.Eq{"token": token}).
 		ToSql()
@@ -30,30 +236,78 @@ func (s *TokenStorage) GetCapacity(ctx context.Context, token string) (int, erro
 		return 0, fmt.Errorf("failed to build query: %w", err)
 	}
 
-	var capacity int
-	err = s.pool.QueryRow(ctx, query, args...).Scan(&capacity)
+	var limit *int
+	err = s.pool.QueryRow(ctx, query, args...).Scan(&limit)
 	if err != nil {
-		return 0, fmt.Errorf("failed to get capacity: %w", err)
+		return 0, fmt.Errorf("failed to get max in flight: %w", err)
 	}
+	if limit == nil {
+		return 0, fmt.Errorf("max in flight %w", model.ErrNotFound)
+	}
+
+	return *limit, nil
+}
 
-	return capacity, nil
+type maxInFlightValue struct {
+	MaxInFlight *int `json:"max_in_flight"`
 }
 
-func (s *TokenStorage) SetCapacity(ctx context.Context, token string, capacity int) error {
+// SetMaxInFlight sets token's own limit, nil resets it to default
+func (s *TokenStorage) SetMaxInFlight(ctx context.Context, actor, token string, limit *int) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var old maxInFlightValue
+	found, err := lockRow(ctx, tx, s.sb.Select("max_in_flight").From("token_buckets").Where(squirrel.Eq{"token": token}), &old.MaxInFlight)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("token %w", model.ErrNotFound)
+	}
+
 	query, args, err := s.sb.
-		Insert("token_buckets").
-		Columns("token", "capacity").
-		Values(token, capacity).
-		Suffix("ON CONFLICT (token) DO UPDATE SET capacity = EXCLUDED.capacity").
+		Update("token_buckets").
+		Set("max_in_flight", limit).
+		Where(squirrel.Eq{"token": token}).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("failed to build query: %w", err)
 	}
 
-	_, err = s.pool.Exec(ctx, query, args...)
+	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
-		return fmt.Errorf("failed to set capacity: %w", err)
+		return fmt.Errorf("failed to set max in flight: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "set_max_in_flight", token, old, maxInFlightValue{MaxInFlight: limit}); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit max in flight: %w", err)
 	}
 
 	return nil
 }
+
+// lockRow scans row selected by query and locks it until the end of transaction, false is returned when there is no row
+func lockRow(ctx context.Context, tx pgx.Tx, sb squirrel.SelectBuilder, dest ...any) (bool, error) {
+	query, args, err := sb.Suffix("FOR UPDATE").ToSql()
+	if err != nil {
+		return false, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	err = tx.QueryRow(ctx, query, args...).Scan(dest...)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to lock row: %w", err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,109 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+var recordColumns = []string{"token", "COALESCE(key_prefix, '')", "capacity", "tenant", "max_in_flight", "expires_at", "revoked_at"}
+
+func scanRecord(row pgx.Row) (model.TokenRecord, error) {
+	var t model.TokenRecord
+	err := row.Scan(&t.TokenHash, &t.KeyPrefix, &t.Capacity, &t.Tenant, &t.MaxInFlight, &t.ExpiresAt, &t.RevokedAt)
+	return t, err
+}
+
+func (s *TokenStorage) GetToken(ctx context.Context, token string) (model.TokenRecord, error) {
+	query, args, err := s.sb.
+		Select(recordColumns...).
+		From("token_buckets").
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return model.TokenRecord{}, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	t, err := scanRecord(s.pool.QueryRow(ctx, query, args...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return t, fmt.Errorf("token %w", model.ErrNotFound)
+	}
+	if err != nil {
+		return t, fmt.Errorf("failed to get token: %w", err)
+	}
+
+	return t, nil
+}
+
+// ListTokens returns up to limit tokens ordered by hash, tokens with hash not greater than after are skipped
+func (s *TokenStorage) ListTokens(ctx context.Context, after string, limit int) ([]model.TokenRecord, error) {
+	query, args, err := s.sb.
+		Select(recordColumns...).
+		From("token_buckets").
+		Where(squirrel.Gt{"token": after}).
+		OrderBy("token").
+		Limit(uint64(limit)).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	tokens, err := pgx.CollectRows(rows, func(row pgx.CollectableRow) (model.TokenRecord, error) {
+		return scanRecord(row)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+
+	return tokens, nil
+}
+
+// DeleteToken deletes token with its schedules, usage and quota counters are kept
+func (s *TokenStorage) DeleteToken(ctx context.Context, actor, token string) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var old model.TokenRecord
+	found, err := lockRow(ctx, tx, s.sb.Select(recordColumns...).From("token_buckets").Where(squirrel.Eq{"token": token}),
+		&old.TokenHash, &old.KeyPrefix, &old.Capacity, &old.Tenant, &old.MaxInFlight, &old.ExpiresAt, &old.RevokedAt)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("token %w", model.ErrNotFound)
+	}
+
+	query, args, err := s.sb.
+		Delete("token_buckets").
+		Where(squirrel.Eq{"token": token}).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed to build query: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+
+	if err := writeAudit(ctx, tx, s.sb, actor, "delete_token", token, old, nil); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit token deletion: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// usageChunk is how many rows are upserted by a single statement
+const usageChunk = 1000
+
+type UsageStorage struct {
+	pool *pgxpool.Pool
+	sb   squirrel.StatementBuilderType
+}
+
+func NewUsageStorage(pool *pgxpool.Pool) *UsageStorage {
+	return &UsageStorage{
+		pool: pool,
+		sb:   squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar),
+	}
+}
+
+// AddUsage adds counters to stored ones in a single transaction, every token and start pair must occur once.
+// Usage of tokens which are not stored is dropped, so anonymous keys do not fill storage
+func (s *UsageStorage) AddUsage(ctx context.Context, usage []model.Usage) error {
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for len(usage) > 0 {
+		chunk := usage[:min(len(usage), usageChunk)]
+		usage = usage[len(chunk):]
+
+		stored, err := s.storedTokens(ctx, tx, chunk)
+		if err != nil {
+			return err
+		}
+		if len(stored) == 0 {
+			continue
+		}
+
+		insert := s.sb.
+			Insert("token_usage").
+			Columns("token", "bucket_start", "allowed", "rejected")
+		for _, u := range chunk {
+			if _, ok := stored[u.Token]; ok {
+				insert = insert.Values(u.Token, u.Start, u.Allowed, u.Rejected)
+			}
+		}
+
+		query, args, err := insert.
+			Suffix("ON CONFLICT (token, bucket_start) DO UPDATE SET " +
+				"allowed = token_usage.allowed + EXCLUDED.allowed, rejected = token_usage.rejected + EXCLUDED.rejected").
+			ToSql()
+		if err != nil {
+			return fmt.Errorf("failed to build query: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to add usage: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit usage: %w", err)
+	}
+
+	return nil
+}
+
+// storedTokens returns which tokens of usage are stored
+func (s *UsageStorage) storedTokens(ctx context.Context, tx pgx.Tx, usage []model.Usage) (map[string]struct{}, error) {
+	tokens := make([]string, 0, len(usage))
+	for _, u := range usage {
+		tokens = append(tokens, u.Token)
+	}
+
+	query, args, err := s.sb.
+		Select("token").
+		From("token_buckets").
+		Where(squirrel.Eq{"token": tokens}).
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stored tokens: %w", err)
+	}
+	defer rows.Close()
+
+	stored := make(map[string]struct{})
+	for rows.Next() {
+		var token string
+		if err := rows.Scan(&token); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
+		}
+		stored[token] = struct{}{}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get stored tokens: %w", err)
+	}
+
+	return stored, nil
+}
+
+// GetUsage returns usage of token within [from, to) aggregated by granularity in timezone
+func (s *UsageStorage) GetUsage(ctx context.Context, token string, from, to time.Time, granularity, timezone string) ([]model.Usage, error) {
+	query, args, err := s.sb.
+		Select().
+		Column(squirrel.Expr("date_trunc(?, bucket_start, ?) AS start", granularity, timezone)).
+		Columns("SUM(allowed)", "SUM(rejected)").
+		From("token_usage").
+		Where(squirrel.Eq{"token": token}).
+		Where(squirrel.GtOrEq{"bucket_start": from}).
+		Where(squirrel.Lt{"bucket_start": to}).
+		GroupBy("start").
+		OrderBy("start").
+		ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build query: %w", err)
+	}
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+	defer rows.Close()
+
+	var usage []model.Usage
+	for rows.Next() {
+		u := model.Usage{Token: token}
+		if err := rows.Scan(&u.Start, &u.Allowed, &u.Rejected); err != nil {
+			return nil, fmt.Errorf("failed to scan usage: %w", err)
+		}
+		usage = append(usage, u)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get usage: %w", err)
+	}
+
+	return usage, nil
+}
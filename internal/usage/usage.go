@@ -0,0 +1,138 @@
+package usage
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Arzeeq/cloud-camp/internal/model"
+)
+
+// Resolution is the size of time buckets usage is aggregated into
+const Resolution = time.Minute
+
+// maxPending bounds how many token buckets wait for flush, new ones are dropped while storage is unavailable
+const maxPending = 100_000
+
+type Servicer interface {
+	AddUsage(usage []model.Usage) error
+}
+
+type bucketKey struct {
+	token string
+	start time.Time
+}
+
+// Recorder aggregates allowed and rejected requests per token in memory
+// and writes them to storage in batches every flush interval
+type Recorder struct {
+	pending map[bucketKey]*model.Usage
+	dropped int
+	mu      sync.Mutex
+	ticker  *time.Ticker
+	done    chan struct{}
+	stopped chan struct{}
+	service Servicer
+	l       *slog.Logger
+}
+
+func New(flushInterval time.Duration, service Servicer, l *slog.Logger) *Recorder {
+	r := &Recorder{
+		pending: make(map[bucketKey]*model.Usage),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		service: service,
+		l:       l,
+	}
+
+	r.ticker = time.NewTicker(flushInterval)
+	go r.run()
+
+	return r
+}
+
+func (r *Recorder) run() {
+	defer close(r.stopped)
+
+	for {
+		select {
+		case <-r.ticker.C:
+			r.flush()
+		case <-r.done:
+			r.flush()
+			return
+		}
+	}
+}
+
+func (r *Recorder) Record(key string, allowed bool) {
+	k := bucketKey{token: key, start: time.Now().UTC().Truncate(Resolution)}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, ok := r.pending[k]
+	if !ok {
+		if len(r.pending) >= maxPending {
+			r.dropped++
+			return
+		}
+
+		u = &model.Usage{Token: k.token, Start: k.start}
+		r.pending[k] = u
+	}
+
+	if allowed {
+		u.Allowed++
+	} else {
+		u.Rejected++
+	}
+}
+
+func (r *Recorder) flush() {
+	r.mu.Lock()
+	pending := r.pending
+	r.pending = make(map[bucketKey]*model.Usage)
+	dropped := r.dropped
+	r.dropped = 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		r.l.Warn("usage was dropped because too much of it is waiting for flush", slog.Int("count", dropped))
+	}
+
+	if len(pending) == 0 {
+		return
+	}
+
+	usage := make([]model.Usage, 0, len(pending))
+	for _, u := range pending {
+		usage = append(usage, *u)
+	}
+
+	if err := r.service.AddUsage(usage); err != nil {
+		r.l.Error(fmt.Sprintf("failed to flush usage: %v", err))
+
+		// counters are merged back to be written with the next batch as long as they fit
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for k, u := range pending {
+			if cur, ok := r.pending[k]; ok {
+				cur.Allowed += u.Allowed
+				cur.Rejected += u.Rejected
+			} else if len(r.pending) < maxPending {
+				r.pending[k] = u
+			} else {
+				r.dropped++
+			}
+		}
+	}
+}
+
+// Stop flushes pending usage and stops recorder
+func (r *Recorder) Stop() {
+	r.ticker.Stop()
+	close(r.done)
+	<-r.stopped
+}